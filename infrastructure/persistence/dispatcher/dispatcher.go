@@ -27,6 +27,7 @@ import (
 // platform playbook-dispatcher application.
 type DispatcherClient interface {
 	Dispatch(ctx context.Context, inputs []RunInputV2) ([]RunCreated, error)
+	Cancel(ctx context.Context, inputs []CancelInputV2) ([]RunCanceled, error)
 }
 
 // dispatcherClientImpl implements DispatcherClient interface.
@@ -86,3 +87,25 @@ func (dc *dispatcherClientImpl) Dispatch(ctx context.Context, inputs []RunInputV
 
 	return *res.JSON207, nil
 }
+
+// Cancel performs the ApiInternalV2RunsCancelWithResponse API method of the
+// playbook-dispatcher service.
+func (dc *dispatcherClientImpl) Cancel(ctx context.Context, inputs []CancelInputV2) ([]RunCanceled, error) {
+	logger := log.With().Str("http_client", "playbook-dispatcher").Logger()
+
+	res, err := dc.client.ApiInternalV2RunsCancelWithResponse(ctx, inputs)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot cancel runs with response")
+		return nil, err
+	}
+	logger.Debug().Str("http_status", res.Status()).Msg("received response from playbook-dispatcher")
+
+	if res.HTTPResponse.StatusCode != 207 {
+		err := fmt.Errorf("unexpected HTTP response - %v (%v)", res.StatusCode(), string(res.Body))
+		logger.Error().Err(err).Msg("received unexpected response from playbook-dispatcher")
+		return nil, err
+	}
+	logger.Debug().Interface("runs_canceled", *res.JSON207).Msg("runs canceled")
+
+	return *res.JSON207, nil
+}
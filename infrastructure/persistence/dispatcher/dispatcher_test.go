@@ -126,3 +126,69 @@ func TestDispatch(t *testing.T) {
 		})
 	}
 }
+
+func TestCancel(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			runs     []CancelInputV2
+			response []byte
+		}
+		want []RunCanceled
+	}{
+		{
+			description: "two responses",
+			input: struct {
+				runs     []CancelInputV2
+				response []byte
+			}{
+				runs: []CancelInputV2{
+					{
+						OrgId:     "0000001",
+						Principal: "test_user",
+						RunId:     uuid.MustParse("3d711f8b-77d0-4ed5-a5b5-1d282bf930c7"),
+					},
+					{
+						OrgId:     "0000001",
+						Principal: "test_user",
+						RunId:     uuid.MustParse("74368f32-4e6d-4ea2-9b8f-22dac89f9ae4"),
+					},
+				},
+				response: []byte(`[{"code":202,"run_id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7"},{"code":409,"run_id":"74368f32-4e6d-4ea2-9b8f-22dac89f9ae4"}]`),
+			},
+			want: []RunCanceled{
+				{
+					Code:  202,
+					RunId: uuid.MustParse("3d711f8b-77d0-4ed5-a5b5-1d282bf930c7"),
+				},
+				{
+					Code:  409,
+					RunId: uuid.MustParse("74368f32-4e6d-4ea2-9b8f-22dac89f9ae4"),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mux := staticmux.StaticMux{}
+			responseBody := test.input.response
+			headers := map[string][]string{"Content-Type": {"application/json"}}
+			mux.AddResponse("/internal/v2/cancel", 207, responseBody, headers)
+
+			server := httptest.NewServer(&mux)
+			defer server.Close()
+
+			config.DefaultConfig.DispatcherHost.Value = url.MustParse(server.URL)
+
+			got, err := NewDispatcherClient().Cancel(context.Background(), test.input.runs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
@@ -106,6 +106,8 @@ func (c *InventoryClient) GetInventoryClients(ctx context.Context, page int) (In
 	return results, nil
 }
 
+// GetAllInventoryClients pages through GetInventoryClients, returning every
+// rhc-connected host visible to the identity stored in ctx.
 func (c *InventoryClient) GetAllInventoryClients(ctx context.Context) ([]internal.Host, error) {
 	var clients []internal.Host
 	inventoryResp, err := c.GetInventoryClients(ctx, 1)
@@ -114,12 +116,14 @@ func (c *InventoryClient) GetAllInventoryClients(ctx context.Context) ([]interna
 	}
 	clients = append(clients, inventoryResp.Results...)
 
-	for len(clients) < inventoryResp.Total {
-		page := inventoryResp.Page + 1
+	for page := inventoryResp.Page + 1; len(clients) < inventoryResp.Total; page++ {
 		res, err := c.GetInventoryClients(ctx, page)
 		if err != nil {
 			return nil, fmt.Errorf("unable to get inventory clients: %w", err)
 		}
+		if len(res.Results) == 0 {
+			break
+		}
 		clients = append(clients, res.Results...)
 	}
 
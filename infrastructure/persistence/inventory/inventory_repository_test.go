@@ -41,10 +41,7 @@ func TestGetInventoryClients(t *testing.T) {
 						ID:          "1234",
 						Account:     "000001",
 						DisplayName: "test",
-						SystemProfile: struct {
-							RHCID    string "json:\"rhc_client_id\""
-							RHCState string "json:\"rhc_config_state\""
-						}{
+						SystemProfile: internal.SystemProfile{
 							RHCID:    "3d711f8b-77d0-4ed5-a5b5-1d282bf930c7",
 							RHCState: "3ef6c247-d913-491b-b3eb-56315a6e0f84",
 						},
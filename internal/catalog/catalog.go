@@ -0,0 +1,168 @@
+// Package catalog describes the services a profile configures on hosts
+// connected through rhc. The catalog is read from services.json, so adding a
+// service only requires a new entry there.
+package catalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Service describes a service that can be configured by a profile.
+type Service struct {
+	Name         string       `json:"name"`
+	Description  string       `json:"description"`
+	Values       []string     `json:"values"`
+	Default      string       `json:"default"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Dependency requires Service to be set to Value whenever the service declaring
+// the dependency is set to When.
+type Dependency struct {
+	When    string `json:"when"`
+	Service string `json:"service"`
+	Value   string `json:"value"`
+}
+
+//go:embed services.json
+var servicesJSON []byte
+
+// services is the catalog, in the order of services.json.
+var services = mustLoad(servicesJSON)
+
+func mustLoad(data []byte) []Service {
+	services, err := load(data)
+	if err != nil {
+		panic(err)
+	}
+	return services
+}
+
+// load unmarshals a catalog and checks that it is consistent.
+func load(data []byte) ([]Service, error) {
+	var services []Service
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal service catalog: %w", err)
+	}
+
+	byName := make(map[string]Service, len(services))
+	for _, service := range services {
+		if _, ok := byName[service.Name]; ok {
+			return nil, fmt.Errorf("duplicate service: %v", service.Name)
+		}
+		if !slices.Contains(service.Values, service.Default) {
+			return nil, fmt.Errorf("invalid default for service %v: %v", service.Name, service.Default)
+		}
+		byName[service.Name] = service
+	}
+
+	for _, service := range services {
+		for _, dependency := range service.Dependencies {
+			if !slices.Contains(service.Values, dependency.When) {
+				return nil, fmt.Errorf("invalid dependency of service %v: unknown value %v", service.Name, dependency.When)
+			}
+			required, ok := byName[dependency.Service]
+			if !ok {
+				return nil, fmt.Errorf("invalid dependency of service %v: unknown service %v", service.Name, dependency.Service)
+			}
+			if !slices.Contains(required.Values, dependency.Value) {
+				return nil, fmt.Errorf("invalid dependency of service %v: unknown value %v of service %v", service.Name, dependency.Value, dependency.Service)
+			}
+		}
+	}
+
+	return services, nil
+}
+
+// Services returns the catalog.
+func Services() []Service {
+	return slices.Clone(services)
+}
+
+// Lookup returns the service with the given name.
+func Lookup(name string) (Service, bool) {
+	i := slices.IndexFunc(services, func(s Service) bool { return s.Name == name })
+	if i < 0 {
+		return Service{}, false
+	}
+	return services[i], true
+}
+
+// Validate returns an error if state contains a service that is not in the
+// catalog, or a value the service does not accept.
+func Validate(state map[string]string) error {
+	for name, value := range state {
+		service, ok := Lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown service: %v", name)
+		}
+		if !slices.Contains(service.Values, value) {
+			return fmt.Errorf("invalid value for service %v: %v", name, value)
+		}
+	}
+
+	return nil
+}
+
+// Complete returns a copy of state in which every service of the catalog
+// missing from state is set to its default value.
+func Complete(state map[string]string) map[string]string {
+	complete := maps.Clone(state)
+	if complete == nil {
+		complete = make(map[string]string, len(services))
+	}
+
+	for _, service := range services {
+		if _, ok := complete[service.Name]; !ok {
+			complete[service.Name] = service.Default
+		}
+	}
+
+	return complete
+}
+
+// Violation describes a dependency that a state map does not satisfy: Service
+// is set to Value, which requires Requires to be set to RequiredValue, but it
+// is set to ActualValue.
+type Violation struct {
+	Service       string `json:"service"`
+	Value         string `json:"value"`
+	Requires      string `json:"requires"`
+	RequiredValue string `json:"required_value"`
+	ActualValue   string `json:"actual_value"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v %v requires %v %v, not %v", v.Service, v.Value, v.Requires, v.RequiredValue, v.ActualValue)
+}
+
+// Check returns the dependencies that state does not satisfy, in catalog
+// order. Services missing from state are checked with their default value.
+func Check(state map[string]string) []Violation {
+	state = Complete(state)
+
+	var violations []Violation
+	for _, service := range services {
+		value := state[service.Name]
+		for _, dependency := range service.Dependencies {
+			if dependency.When != value {
+				continue
+			}
+			if actual := state[dependency.Service]; actual != dependency.Value {
+				violations = append(violations, Violation{
+					Service:       service.Name,
+					Value:         value,
+					Requires:      dependency.Service,
+					RequiredValue: dependency.Value,
+					ActualValue:   actual,
+				})
+			}
+		}
+	}
+
+	return violations
+}
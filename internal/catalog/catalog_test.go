@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		description string
+		input       []byte
+		wantError   bool
+	}{
+		{
+			description: "embedded catalog",
+			input:       servicesJSON,
+		},
+		{
+			description: "duplicate service",
+			input:       []byte(`[{"name":"insights","values":["enabled"],"default":"enabled"},{"name":"insights","values":["enabled"],"default":"enabled"}]`),
+			wantError:   true,
+		},
+		{
+			description: "invalid default",
+			input:       []byte(`[{"name":"insights","values":["enabled","disabled"],"default":"on"}]`),
+			wantError:   true,
+		},
+		{
+			description: "dependency on unknown service",
+			input:       []byte(`[{"name":"insights","values":["enabled"],"default":"enabled","dependencies":[{"when":"enabled","service":"malware","value":"enabled"}]}]`),
+			wantError:   true,
+		},
+		{
+			description: "dependency on unknown value",
+			input:       []byte(`[{"name":"insights","values":["enabled"],"default":"enabled"},{"name":"remediations","values":["enabled"],"default":"enabled","dependencies":[{"when":"enabled","service":"insights","value":"on"}]}]`),
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := load(test.input)
+			if test.wantError != (err != nil) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		description string
+		input       map[string]string
+		wantError   bool
+	}{
+		{
+			description: "all services",
+			input:       map[string]string{"insights": "enabled", "remediations": "disabled", "compliance_openscap": "enabled"},
+		},
+		{
+			description: "empty",
+			input:       map[string]string{},
+		},
+		{
+			description: "unknown service",
+			input:       map[string]string{"malware": "enabled"},
+			wantError:   true,
+		},
+		{
+			description: "invalid value",
+			input:       map[string]string{"insights": "on"},
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := Validate(test.input)
+			if test.wantError != (err != nil) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		description string
+		input       map[string]string
+		want        map[string]string
+	}{
+		{
+			description: "nil",
+			input:       nil,
+			want:        map[string]string{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+		},
+		{
+			description: "partial",
+			input:       map[string]string{"insights": "disabled"},
+			want:        map[string]string{"insights": "disabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := Complete(test.input)
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		description string
+		input       map[string]string
+		want        []Violation
+	}{
+		{
+			description: "all enabled",
+			input:       map[string]string{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+			want:        nil,
+		},
+		{
+			description: "all disabled",
+			input:       map[string]string{"insights": "disabled", "remediations": "disabled", "compliance_openscap": "disabled"},
+			want:        nil,
+		},
+		{
+			description: "remediations without insights",
+			input:       map[string]string{"insights": "disabled", "remediations": "enabled", "compliance_openscap": "disabled"},
+			want: []Violation{
+				{Service: "remediations", Value: "enabled", Requires: "insights", RequiredValue: "enabled", ActualValue: "disabled"},
+			},
+		},
+		{
+			description: "defaults apply to missing services",
+			input:       map[string]string{"insights": "disabled"},
+			want: []Violation{
+				{Service: "remediations", Value: "enabled", Requires: "insights", RequiredValue: "enabled", ActualValue: "disabled"},
+				{Service: "compliance_openscap", Value: "enabled", Requires: "insights", RequiredValue: "enabled", ActualValue: "disabled"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := Check(test.input)
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
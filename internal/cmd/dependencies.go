@@ -0,0 +1,24 @@
+// Package cmd holds what the subcommands of config-manager share.
+package cmd
+
+import (
+	"config-manager/infrastructure/persistence/dispatcher"
+	"config-manager/internal/reconcile"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dependencies are the database and clients that main creates and passes to
+// the subcommands. main sets them once the flags are parsed, before any
+// subcommand runs.
+type Dependencies struct {
+	// DB is the database the subcommands create their repositories on.
+	DB *sqlx.DB
+
+	// Applier applies profiles to hosts by dispatching runs.
+	Applier *reconcile.Reconciler
+
+	// Dispatcher is the playbook-dispatcher client Applier dispatches runs
+	// with, also used to cancel them.
+	Dispatcher dispatcher.DispatcherClient
+}
@@ -0,0 +1,254 @@
+package dispatcherconsumer
+
+import (
+	"config-manager/internal/cmd"
+	"config-manager/internal/config"
+	"config-manager/internal/consumer"
+	"config-manager/internal/db"
+	"config-manager/internal/reconcile"
+	"config-manager/internal/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/rs/zerolog/log"
+	"github.com/segmentio/kafka-go"
+)
+
+// NewCommand creates the dispatcher-consumer subcommand, which records the
+// outcome of runs in the database of deps.
+func NewCommand(deps *cmd.Dependencies) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "dispatcher-consumer",
+		ShortHelp: "Run the playbook-dispatcher kafka consumer",
+		LongHelp:  "Consumes messages from the 'kafka-dispatcher-topic' topic and records the outcome of the runs created by config-manager.",
+		Exec: func(ctx context.Context, args []string) error {
+			return run(ctx, deps)
+		},
+	}
+}
+
+// run consumes playbook-dispatcher events until ctx is cancelled, then waits
+// for the in-flight handlers to finish.
+func run(ctx context.Context, deps *cmd.Dependencies) error {
+	log.Info().Str("command", "dispatcher-consumer").Msg("started consumer. Awaiting messages.")
+
+	hostRuns := db.NewHostRunRepository(deps.DB)
+	defer hostRuns.Close()
+
+	w := util.Kafka.NewWriter(config.DefaultConfig.KafkaSysProfileTopic)
+	deadLetters := util.Kafka.NewWriter(config.DefaultConfig.KafkaRunDeadLetters)
+
+	h := &runHandler{hostRuns: hostRuns, writer: w, deadLetters: deadLetters}
+
+	reader := util.Kafka.NewReader(config.DefaultConfig.KafkaDispatcherTopic)
+	offsets := consumer.NewOffsetTracker()
+
+	// In-flight handlers are allowed to finish after ctx is cancelled, so
+	// they run with a context that is not cancelled along with it.
+	pool := consumer.NewWorkerPool(context.WithoutCancel(ctx), "dispatcher-consumer", config.DefaultConfig.ConsumerWorkers, config.DefaultConfig.ConsumerMaxInFlight, func(ctx context.Context, m kafka.Message) {
+		h.consume(ctx, m, offsets, reader)
+	})
+
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Error().Err(err).Msg("unable to fetch message")
+			continue
+		}
+		offsets.Fetched(m)
+		if err := pool.Submit(ctx, runKey(m), m); err != nil {
+			break
+		}
+	}
+
+	log.Info().Str("command", "dispatcher-consumer").Msg("shutting down consumer")
+
+	if !pool.Close(config.DefaultConfig.ShutdownTimeout) {
+		log.Warn().Str("command", "dispatcher-consumer").Msg("timed out waiting for handlers to finish")
+	}
+
+	if err := reader.Close(); err != nil {
+		return fmt.Errorf("cannot close kafka reader: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("cannot close kafka writer: %w", err)
+	}
+
+	if err := deadLetters.Close(); err != nil {
+		return fmt.Errorf("cannot close kafka writer: %w", err)
+	}
+
+	return nil
+}
+
+// runHandler holds the dependencies used to handle playbook-dispatcher run
+// events. It is created by run.
+type runHandler struct {
+	// hostRuns is used to record the status of runs.
+	hostRuns db.HostRunRepository
+
+	// writer is used to update the system profile of hosts that successfully
+	// applied a profile.
+	writer consumer.MessageWriter
+
+	// deadLetters is used to set aside messages that cannot be handled.
+	deadLetters consumer.MessageWriter
+}
+
+// errInvalidEvent is wrapped by errors returned by handler when a message can
+// never be handled, no matter how often it is retried.
+var errInvalidEvent = errors.New("invalid run event")
+
+// RunEvent represents a message read off the playbook-dispatcher.runs topic.
+type RunEvent struct {
+	EventType string `json:"event_type"`
+	Payload   struct {
+		ID            string            `json:"id"`
+		OrgID         string            `json:"org_id"`
+		Recipient     string            `json:"recipient"`
+		CorrelationID string            `json:"correlation_id"`
+		Service       string            `json:"service"`
+		URL           string            `json:"url"`
+		Labels        map[string]string `json:"labels"`
+		Status        string            `json:"status"`
+		CreatedAt     time.Time         `json:"created_at"`
+		UpdatedAt     time.Time         `json:"updated_at"`
+	} `json:"payload"`
+}
+
+// SystemProfileUpdate represents a message written to the
+// platform.inventory.system-profile topic.
+type SystemProfileUpdate struct {
+	Operation string `json:"operation"`
+	Data      struct {
+		ID            string            `json:"id"`
+		OrgID         string            `json:"org_id"`
+		SystemProfile map[string]string `json:"system_profile"`
+	} `json:"data"`
+}
+
+// statuses maps the terminal playbook-dispatcher run statuses to host run
+// statuses. Runs in any other status are still in progress.
+var statuses = map[string]string{
+	"success":  db.HostRunStatusSuccess,
+	"failure":  db.HostRunStatusFailure,
+	"timeout":  db.HostRunStatusTimeout,
+	"canceled": db.HostRunStatusCanceled,
+}
+
+// runKey returns the run ID of the event in msg, used to route all events of a
+// run to the same worker so that they are handled in order. The message key is
+// used if the value cannot be parsed; handler reports the error.
+func runKey(msg kafka.Message) string {
+	var event struct {
+		Payload struct {
+			ID string `json:"id"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.Payload.ID == "" {
+		return string(msg.Key)
+	}
+
+	return event.Payload.ID
+}
+
+// consume processes msg and commits the latest offset of its partition that is
+// done. msg is done even if it cannot be processed, so that a single message
+// never stops the offsets of its partition from being committed.
+func (h *runHandler) consume(ctx context.Context, msg kafka.Message, offsets *consumer.OffsetTracker, committer consumer.MessageCommitter) {
+	if err := h.process(ctx, msg); err != nil {
+		log.Error().Err(err).Str("module", "dispatcher-consumer").Int("partition", msg.Partition).Int64("offset", msg.Offset).Bytes("value", msg.Value).Msg("cannot process message, skipping it")
+	}
+
+	if commit, ok := offsets.Done(msg); ok {
+		if err := committer.CommitMessages(ctx, commit); err != nil {
+			log.Error().Err(err).Int("partition", commit.Partition).Int64("offset", commit.Offset).Msg("cannot commit message")
+		}
+	}
+}
+
+// process handles msg, writing it to the dead-letter topic if it is invalid or
+// cannot be handled even after retrying. It returns an error only if msg could
+// neither be handled nor set aside.
+func (h *runHandler) process(ctx context.Context, msg kafka.Message) error {
+	err := h.handler(ctx, msg)
+	if err == nil {
+		return nil
+	}
+
+	log.Error().Err(err).Str("module", "dispatcher-consumer").Int("partition", msg.Partition).Int64("offset", msg.Offset).Msg("writing message to dead-letter topic")
+
+	return consumer.DeadLetter(ctx, h.deadLetters, msg, err)
+}
+
+// handler records the outcome of a single playbook-dispatcher run event.
+// Errors wrapping errInvalidEvent indicate msg cannot be parsed; other errors
+// indicate the outcome could not be recorded even after retrying transient
+// database errors.
+func (h *runHandler) handler(ctx context.Context, msg kafka.Message) error {
+	logger := log.With().Str("module", "dispatcher-consumer").Int64("offset", msg.Offset).Logger()
+
+	event := &RunEvent{}
+
+	if err := json.Unmarshal(msg.Value, event); err != nil {
+		return fmt.Errorf("%w: cannot unmarshal run event: %w", errInvalidEvent, err)
+	}
+	logger = logger.With().Str("event_type", event.EventType).Str("run_id", event.Payload.ID).Str("org_id", event.Payload.OrgID).Str("status", event.Payload.Status).Logger()
+
+	// Process a message only if the run was created by config-manager
+	if event.Payload.Labels[reconcile.LabelService] != reconcile.ServiceName {
+		logger.Trace().Msg("skipping run not created by config-manager")
+		return nil
+	}
+
+	status, ok := statuses[event.Payload.Status]
+	if !ok {
+		logger.Debug().Msg("skipping run in progress")
+		return nil
+	}
+
+	var run *db.HostRun
+	err := consumer.Retry(ctx, func() error {
+		var err error
+		run, err = h.hostRuns.UpdateHostRunStatus(ctx, event.Payload.ID, status)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot update host run status: %w", err)
+	}
+	if run == nil {
+		logger.Debug().Msg("skipping unknown or deleted host run")
+		return nil
+	}
+	logger = logger.With().Str("host_id", run.HostID.String()).Str("profile_id", run.ProfileID.String()).Logger()
+	logger.Info().Msg("updated host run status")
+
+	if run.Status != db.HostRunStatusSuccess {
+		return nil
+	}
+
+	update := SystemProfileUpdate{Operation: "update"}
+	update.Data.ID = run.HostID.String()
+	update.Data.OrgID = run.OrgID
+	update.Data.SystemProfile = map[string]string{"rhc_config_state": run.ProfileID.String()}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("cannot marshal system profile update: %w", err)
+	}
+
+	if err := h.writer.WriteMessages(ctx, kafka.Message{Key: []byte(run.HostID.String()), Value: data}); err != nil {
+		return fmt.Errorf("cannot write system profile update: %w", err)
+	}
+	logger.Debug().Msg("updated host rhc_config_state")
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package dispatcherconsumer
+
+import (
+	"config-manager/internal/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/google/go-cmp/cmp"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	UNIXTime string = "1970-01-01T00:00:00Z"
+)
+
+var (
+	DSN  string
+	port uint32
+)
+
+func TestMain(m *testing.M) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	port = uint32(r.Int31n(10000-9876) + 9876)
+	DSN = fmt.Sprintf("host=localhost port=%v user=postgres password=postgres dbname=postgres sslmode=disable", port)
+
+	runtimedir, err := os.MkdirTemp("", "config-manager-internal-cmd-dispatcherconsumer.")
+	if err != nil {
+		log.Fatalf("cannot make temp dir: %v", err)
+	}
+	postgres := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().Port(port).RuntimePath(runtimedir))
+
+	if err := postgres.Start(); err != nil {
+		log.Fatalf("failed to start database: %v", err)
+	}
+
+	code := m.Run()
+
+	if err := postgres.Stop(); err != nil {
+		log.Fatalf("failed to stop database: %v", err)
+	}
+
+	if err := os.RemoveAll(runtimedir); err != nil {
+		log.Fatalf("cannot remove temp dir: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+// fakeWriter records the messages passed to WriteMessages.
+type fakeWriter struct {
+	messages []kafka.Message
+}
+
+func (f *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.messages = append(f.messages, msgs...)
+	return nil
+}
+
+// fakeHostRuns fails every status update with err. Its other methods are not
+// implemented.
+type fakeHostRuns struct {
+	db.HostRunRepository
+	err error
+}
+
+func (f *fakeHostRuns) UpdateHostRunStatus(ctx context.Context, runID string, status string) (*db.HostRun, error) {
+	return nil, f.err
+}
+
+func TestProcessDeadLetter(t *testing.T) {
+	tests := []struct {
+		description string
+		input       kafka.Message
+		want        int
+	}{
+		{
+			description: "invalid message",
+			input:       kafka.Message{Value: []byte(`{`)},
+			want:        1,
+		},
+		{
+			description: "run created by another service",
+			input: kafka.Message{
+				Value: []byte(`{"event_type":"update","payload":{"id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","org_id":"78606","labels":{},"status":"success"}}`),
+			},
+			want: 0,
+		},
+		{
+			description: "status update failure",
+			input: kafka.Message{
+				Value: []byte(`{"event_type":"update","payload":{"id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","org_id":"78606","labels":{"service":"config_manager"},"status":"success"}}`),
+			},
+			want: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fake := &fakeWriter{}
+			h := &runHandler{hostRuns: &fakeHostRuns{err: errors.New("permission denied")}, deadLetters: fake}
+
+			if err := h.process(context.Background(), test.input); err != nil {
+				t.Fatalf("failed to process message: %v", err)
+			}
+
+			if len(fake.messages) != test.want {
+				t.Fatalf("%v != %v", len(fake.messages), test.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	seed := []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'pending');`)
+
+	tests := []struct {
+		description  string
+		input        kafka.Message
+		wantStatus   string
+		wantMessages []SystemProfileUpdate
+	}{
+		{
+			description: "successful run",
+			input: kafka.Message{
+				Value: []byte(`{"event_type":"update","payload":{"id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","org_id":"78606","service":"config_manager","labels":{"service":"config_manager","profile_id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a"},"status":"success"}}`),
+			},
+			wantStatus: db.HostRunStatusSuccess,
+			wantMessages: func() []SystemProfileUpdate {
+				update := SystemProfileUpdate{Operation: "update"}
+				update.Data.ID = "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"
+				update.Data.OrgID = "78606"
+				update.Data.SystemProfile = map[string]string{"rhc_config_state": "b5db9cbc-4ecd-464b-b416-3a6cd67af87a"}
+				return []SystemProfileUpdate{update}
+			}(),
+		},
+		{
+			description: "timed out run",
+			input: kafka.Message{
+				Value: []byte(`{"event_type":"update","payload":{"id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","org_id":"78606","labels":{"service":"config_manager"},"status":"timeout"}}`),
+			},
+			wantStatus: db.HostRunStatusTimeout,
+		},
+		{
+			description: "running run",
+			input: kafka.Message{
+				Value: []byte(`{"event_type":"create","payload":{"id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","org_id":"78606","labels":{"service":"config_manager"},"status":"running"}}`),
+			},
+			wantStatus: db.HostRunStatusPending,
+		},
+		{
+			description: "run created by another service",
+			input: kafka.Message{
+				Value: []byte(`{"event_type":"update","payload":{"id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","org_id":"78606","service":"remediations","labels":{},"status":"success"}}`),
+			},
+			wantStatus: db.HostRunStatusPending,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			if err := db.SeedData(database, seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			hostRuns := db.NewHostRunRepository(database)
+			defer hostRuns.Close()
+
+			fake := &fakeWriter{}
+			h := &runHandler{hostRuns: hostRuns, writer: fake}
+
+			if err := h.handler(context.Background(), test.input); err != nil {
+				t.Fatalf("failed to handle message: %v", err)
+			}
+
+			run, err := hostRuns.GetCurrentHostRun(context.Background(), "78606", "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60")
+			if err != nil {
+				t.Fatalf("failed to get host run: %v", err)
+			}
+			if run.Status != test.wantStatus {
+				t.Errorf("%v != %v", run.Status, test.wantStatus)
+			}
+
+			var got []SystemProfileUpdate
+			for _, msg := range fake.messages {
+				var update SystemProfileUpdate
+				if err := json.Unmarshal(msg.Value, &update); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, update)
+			}
+
+			if !cmp.Equal(got, test.wantMessages) {
+				t.Errorf("%v", cmp.Diff(got, test.wantMessages))
+			}
+		})
+	}
+}
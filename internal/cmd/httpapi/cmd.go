@@ -1,12 +1,15 @@
 package httpapi
 
 import (
+	"config-manager/internal/cmd"
 	"config-manager/internal/config"
+	"config-manager/internal/db"
 	v2 "config-manager/internal/http/v2"
 	"context"
 	"fmt"
 	"net/http"
 	"path"
+	"time"
 
 	chiprometheus "github.com/766b/chi-prometheus"
 	"github.com/go-chi/chi/v5"
@@ -14,27 +17,74 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var Command ffcli.Command = ffcli.Command{
-	Name:      "http-api",
-	ShortHelp: "Run the HTTP API server",
-	Exec: func(ctx context.Context, args []string) error {
-		log.Info().Str("command", "http-api").Msg("started HTTP API server. Awaiting requests.")
+// NewCommand creates the http-api subcommand, which serves the API from the
+// database and applier of deps.
+func NewCommand(deps *cmd.Dependencies) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "http-api",
+		ShortHelp: "Run the HTTP API server",
+		Exec: func(ctx context.Context, args []string) error {
+			return run(ctx, deps)
+		},
+	}
+}
+
+// run serves the API until ctx is cancelled, then shuts down gracefully.
+func run(ctx context.Context, deps *cmd.Dependencies) error {
+	log.Info().Str("command", "http-api").Msg("started HTTP API server. Awaiting requests.")
+
+	profiles := db.NewProfileRepository(deps.DB)
+	defer profiles.Close()
+
+	hostRuns := db.NewHostRunRepository(deps.DB)
+	defer hostRuns.Close()
+
+	templates := db.NewTemplateRepository(deps.DB)
+	defer templates.Close()
+
+	v2r, err := v2.NewMux(profiles, hostRuns, templates, deps.Applier)
+	if err != nil {
+		return fmt.Errorf("cannot create HTTP router: %w", err)
+	}
 
-		v2r, err := v2.NewMux()
-		if err != nil {
-			return fmt.Errorf("cannot create HTTP router: %w", err)
-		}
+	router := chi.NewMux()
+	router.Use(chiprometheus.NewMiddleware(config.DefaultConfig.AppName))
+	router.Mount(path.Join("/", config.DefaultConfig.URLPathPrefix, config.DefaultConfig.AppName, "v2"), v2r)
 
-		router := chi.NewMux()
-		router.Use(chiprometheus.NewMiddleware(config.DefaultConfig.AppName))
-		router.Mount(path.Join("/", config.DefaultConfig.URLPathPrefix, config.DefaultConfig.AppName, "v2"), v2r)
+	addr := fmt.Sprintf("0.0.0.0:%v", config.DefaultConfig.WebPort)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
 
-		addr := fmt.Sprintf("0.0.0.0:%v", config.DefaultConfig.WebPort)
+	errs := make(chan error, 1)
+	go func() {
 		log.Info().Str("addr", addr).Msg("listening and serving")
-		if err := http.ListenAndServe(addr, router); err != nil {
-			return fmt.Errorf("cannot listen on port %v: %w", config.DefaultConfig.WebPort, err)
-		}
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("cannot listen on port %v: %w", config.DefaultConfig.WebPort, err)
+	case <-ctx.Done():
+	}
+
+	log.Info().Str("command", "http-api").Msg("shutting down HTTP API server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.DefaultConfig.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("cannot shut down HTTP API server: %w", err)
+	}
+
+	// Profiles saved by the last requests may still be being applied, and
+	// the database is closed once the command returns. They get what is
+	// left of the shutdown timeout.
+	deadline, _ := shutdownCtx.Deadline()
+	if !v2r.Wait(time.Until(deadline)) {
+		log.Warn().Str("command", "http-api").Msg("timed out waiting for profiles to be applied")
+	}
 
-		return nil
-	},
+	return nil
 }
@@ -1,67 +1,239 @@
 package inventoryconsumer
 
 import (
+	"config-manager/infrastructure/persistence/dispatcher"
 	"config-manager/internal"
+	"config-manager/internal/cmd"
 	"config-manager/internal/config"
+	"config-manager/internal/consumer"
 	"config-manager/internal/db"
+	"config-manager/internal/instrumentation"
+	"config-manager/internal/reconcile"
+	"config-manager/internal/templates"
 	"config-manager/internal/util"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/segmentio/kafka-go"
 )
 
-var Command ffcli.Command = ffcli.Command{
-	Name:      "inventory-consumer",
-	ShortHelp: "Run the inventory kafka consumer",
-	LongHelp:  "Consumes messages from the 'kafka-inventory-topic' topic and attempts to configure the identified hosts for remote configuration management.",
-	Exec: func(ctx context.Context, args []string) error {
-		log.Info().Str("command", "inventory-consumer").Msg("started consumer. Awaiting messages.")
+// NewCommand creates the inventory-consumer subcommand, which applies profiles
+// with the applier of deps and cancels runs with its dispatcher client.
+func NewCommand(deps *cmd.Dependencies) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "inventory-consumer",
+		ShortHelp: "Run the inventory kafka consumer",
+		LongHelp:  "Consumes messages from the 'kafka-inventory-topic' topic and attempts to configure the identified hosts for remote configuration management.",
+		Exec: func(ctx context.Context, args []string) error {
+			return run(ctx, deps)
+		},
+	}
+}
 
-		reader := util.Kafka.NewReader(config.DefaultConfig.KafkaInventoryTopic)
+// run consumes inventory events until ctx is cancelled, then waits for the
+// in-flight handlers to finish.
+func run(ctx context.Context, deps *cmd.Dependencies) error {
+	log.Info().Str("command", "inventory-consumer").Msg("started consumer. Awaiting messages.")
 
-		for {
-			m, err := reader.ReadMessage(ctx)
-			if err != nil {
-				log.Error().Err(err).Msg("unable to read message")
-				continue
+	profiles := db.NewProfileRepository(deps.DB)
+	defer profiles.Close()
+
+	hostRuns := db.NewHostRunRepository(deps.DB)
+	defer hostRuns.Close()
+
+	templates := db.NewTemplateRepository(deps.DB)
+	defer templates.Close()
+
+	w := util.Kafka.NewWriter(config.DefaultConfig.KafkaDeadLetterTopic)
+
+	h := &inventoryHandler{
+		profiles:    profiles,
+		templates:   templates,
+		hostRuns:    hostRuns,
+		applier:     deps.Applier,
+		canceler:    deps.Dispatcher,
+		deadLetters: w,
+	}
+
+	if since := config.DefaultConfig.KafkaReplaySince.Value; !since.IsZero() {
+		offsets, err := util.Kafka.SeekGroup(ctx, config.DefaultConfig.KafkaInventoryTopic, since)
+		if err != nil {
+			return fmt.Errorf("cannot replay inventory events: %w", err)
+		}
+		log.Info().Str("command", "inventory-consumer").Time("since", since).Interface("offsets", offsets).Msg("replaying inventory events")
+	}
+
+	reader := util.Kafka.NewReader(config.DefaultConfig.KafkaInventoryTopic)
+	offsets := consumer.NewOffsetTracker()
+
+	// In-flight handlers are allowed to finish after ctx is cancelled, so
+	// they run with a context that is not cancelled along with it.
+	pool := consumer.NewWorkerPool(context.WithoutCancel(ctx), "inventory-consumer", config.DefaultConfig.ConsumerWorkers, config.DefaultConfig.ConsumerMaxInFlight, func(ctx context.Context, m kafka.Message) {
+		h.consume(ctx, m, offsets, reader)
+	})
+
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
 			}
-			go handler(ctx, m)
+			log.Error().Err(err).Msg("unable to fetch message")
+			continue
 		}
-	},
+		offsets.Fetched(m)
+		if err := pool.Submit(ctx, orgKey(m), m); err != nil {
+			break
+		}
+	}
+
+	log.Info().Str("command", "inventory-consumer").Msg("shutting down consumer")
+
+	if !pool.Close(config.DefaultConfig.ShutdownTimeout) {
+		log.Warn().Str("command", "inventory-consumer").Msg("timed out waiting for handlers to finish")
+	}
+
+	if err := reader.Close(); err != nil {
+		return fmt.Errorf("cannot close kafka reader: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("cannot close kafka writer: %w", err)
+	}
+
+	return nil
+}
+
+// hostApplier applies a profile to a set of hosts.
+type hostApplier interface {
+	ApplyProfileToHosts(ctx context.Context, profile db.Profile, hosts []internal.Host, principal string) ([]reconcile.Run, error)
 }
 
-// InventoryEvent represents a message read off the inventory.events
-// topic.
-type InventoryEvent struct {
-	Type      string        `json:"type"`
-	Timestamp time.Time     `json:"timestamp"`
-	Host      internal.Host `json:"host"`
+// runCanceler cancels playbook-dispatcher runs.
+type runCanceler interface {
+	Cancel(ctx context.Context, inputs []dispatcher.CancelInputV2) ([]dispatcher.RunCanceled, error)
 }
 
-func handler(ctx context.Context, msg kafka.Message) {
+// inventoryHandler holds the dependencies used to handle inventory events. It
+// is created by run.
+type inventoryHandler struct {
+	// profiles and templates are used to get the current profile of an org.
+	profiles  db.ProfileRepository
+	templates db.TemplateRepository
+
+	// hostRuns is used to tombstone the host runs of hosts deleted from
+	// inventory.
+	hostRuns db.HostRunRepository
+
+	// applier is used to apply the current profile to hosts whose
+	// configuration is out of date.
+	applier hostApplier
+
+	// canceler is used to cancel the pending runs of hosts deleted from
+	// inventory.
+	canceler runCanceler
+
+	// deadLetters is used to set aside messages that cannot be handled.
+	deadLetters consumer.MessageWriter
+}
+
+// errInvalidEvent is wrapped by errors returned by handler when a message can
+// never be handled, no matter how often it is retried.
+var errInvalidEvent = errors.New("invalid inventory event")
+
+// orgKey returns the org ID of the host in msg, used to route all events of an
+// org to the same worker. The message key is used if the value cannot be
+// parsed; handler reports the error.
+func orgKey(msg kafka.Message) string {
+	var event struct {
+		OrgID string `json:"org_id"`
+		Host  struct {
+			OrgID string `json:"org_id"`
+		} `json:"host"`
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return string(msg.Key)
+	}
+
+	switch {
+	case event.Host.OrgID != "":
+		return event.Host.OrgID
+	case event.OrgID != "":
+		return event.OrgID
+	default:
+		return string(msg.Key)
+	}
+}
+
+// consume processes msg and commits the latest offset of its partition that is
+// done. msg is done even if it cannot be processed, so that a single message
+// never stops the offsets of its partition from being committed.
+func (h *inventoryHandler) consume(ctx context.Context, msg kafka.Message, offsets *consumer.OffsetTracker, committer consumer.MessageCommitter) {
+	if err := h.process(ctx, msg); err != nil {
+		log.Error().Err(err).Str("module", "inventory-consumer").Int("partition", msg.Partition).Int64("offset", msg.Offset).Bytes("value", msg.Value).Msg("cannot process message, skipping it")
+	}
+
+	if commit, ok := offsets.Done(msg); ok {
+		if err := committer.CommitMessages(ctx, commit); err != nil {
+			log.Error().Err(err).Int("partition", commit.Partition).Int64("offset", commit.Offset).Msg("cannot commit message")
+		}
+	}
+}
+
+// process handles msg, writing it to the dead-letter topic if it is invalid or
+// cannot be handled even after retrying. It returns an error only if msg could
+// neither be handled nor set aside.
+func (h *inventoryHandler) process(ctx context.Context, msg kafka.Message) error {
+	err := h.handler(ctx, msg)
+	if err == nil {
+		return nil
+	}
+
+	log.Error().Err(err).Str("module", "inventory-consumer").Int("partition", msg.Partition).Int64("offset", msg.Offset).Msg("writing message to dead-letter topic")
+
+	return consumer.DeadLetter(ctx, h.deadLetters, msg, err)
+}
+
+// handler handles a single inventory event. Errors wrapping errInvalidEvent
+// indicate msg cannot be parsed; other errors indicate msg could not be handled
+// even after retrying transient database errors.
+func (h *inventoryHandler) handler(ctx context.Context, msg kafka.Message) error {
 	logger := log.With().Str("module", "inventory-consumer").Int64("offset", msg.Offset).Logger()
 
 	eventType, err := util.Kafka.GetHeader(msg, "event_type")
 	if err != nil {
-		logger.Error().Err(err).Msg("error getting event_type")
-		return
+		return fmt.Errorf("%w: cannot get event_type: %w", errInvalidEvent, err)
 	}
 	logger = logger.With().Str("event_type", eventType).Logger()
 
-	event := &InventoryEvent{}
+	if !knownEventType(eventType) {
+		instrumentation.InventoryUnknownEvent()
+		logger.Debug().Msg("skipping inventory event of unknown type")
+		return nil
+	}
+
+	event, err := parseEvent(eventType, msg.Value)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidEvent, err)
+	}
 
-	if err := json.Unmarshal(msg.Value, event); err != nil {
-		logger.Error().Err(err).Msg("cannot unmarshal inventory event")
-		return
+	// Delete events are handled regardless of age so that deleted hosts are
+	// never left behind.
+	if eventType == EventTypeDelete {
+		return h.deleteHost(ctx, event, logger)
 	}
 
 	if !event.Timestamp.IsZero() && time.Since(event.Timestamp) > config.DefaultConfig.StaleEventDuration {
 		logger.Info().Msg("skipping stale inventory event")
-		return
+		return nil
 	}
 
 	// Process a message only if a host is connected via Cloud Connector
@@ -69,24 +241,118 @@ func handler(ctx context.Context, msg kafka.Message) {
 
 	if isConnected {
 		switch eventType {
-		case "created", "updated":
+		case EventTypeCreated, EventTypeUpdated:
 			reqID, _ := util.Kafka.GetHeader(msg, "request_id")
 			logger = logger.With().Str("request_id", reqID).Str("host_id", event.Host.ID).Str("org_id", event.Host.OrgID).Logger()
-			var defaultState map[string]string
-			if err := json.Unmarshal([]byte(config.DefaultConfig.ServiceConfig), &defaultState); err != nil {
-				logger.Error().Err(err).Msg("cannot unmarshal service config")
-				return
-			}
 
-			profile, err := db.GetOrInsertCurrentProfile(event.Host.OrgID, db.NewProfile(event.Host.OrgID, event.Host.Account, defaultState))
+			var profile *db.Profile
+			err := consumer.Retry(ctx, func() error {
+				var err error
+				profile, err = templates.CurrentProfile(ctx, h.profiles, h.templates, event.Host.OrgID, event.Host.Account, "", db.SourceInventoryConsumer)
+				return err
+			})
 			if err != nil {
-				logger.Error().Err(err).Msg("cannot get profile from database")
-				return
+				return fmt.Errorf("cannot get profile from database: %w", err)
 			}
 
 			if !profile.OrgID.Valid {
 				logger.Error().Str("account_number", db.JSONNullStringSafeValue(profile.AccountID)).Msg("profile missing org ID")
 			}
+
+			logger = logger.With().Str("profile_id", profile.ID.String()).Str("rhc_config_state", event.Host.SystemProfile.RHCState).Logger()
+
+			if event.Host.SystemProfile.RHCState == profile.ID.String() {
+				logger.Debug().Msg("host configuration is up to date")
+				return nil
+			}
+
+			if !profile.Active {
+				logger.Debug().Msg("profile is not active, skipping host")
+				return nil
+			}
+
+			// Inventory sends many updates per host; a run applying the
+			// profile that is still pending is not dispatched again.
+			var run *db.HostRun
+			err = consumer.Retry(ctx, func() error {
+				var err error
+				run, err = h.hostRuns.GetCurrentHostRun(ctx, event.Host.OrgID, event.Host.ID)
+				return err
+			})
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("cannot get host run from database: %w", err)
+			}
+			if err == nil && run.ProfileID == profile.ID && run.Status == db.HostRunStatusPending {
+				logger.Debug().Str("run_id", run.RunID.UUID.String()).Msg("profile is already being applied, skipping host")
+				return nil
+			}
+
+			runs, err := h.applier.ApplyProfileToHosts(ctx, *profile, []internal.Host{event.Host}, config.DefaultConfig.AppName)
+			if err != nil {
+				// Dispatch failures are not retried; runs that were created
+				// would be dispatched again.
+				logger.Error().Err(err).Msg("cannot apply profile to host")
+				return nil
+			}
+			logger.Info().Interface("runs", runs).Msg("applied profile to host")
 		}
 	}
+
+	return nil
+}
+
+// deleteHost tombstones the host runs of the host deleted by event and cancels
+// its pending runs.
+func (h *inventoryHandler) deleteHost(ctx context.Context, event *InventoryEvent, logger zerolog.Logger) error {
+	logger = logger.With().Str("host_id", event.ID).Str("org_id", event.OrgID).Logger()
+
+	var runs []db.HostRun
+	err := consumer.Retry(ctx, func() error {
+		var err error
+		runs, err = h.hostRuns.DeleteHostRuns(ctx, event.OrgID, event.ID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot delete host runs: %w", err)
+	}
+
+	instrumentation.InventoryHostDeleted()
+	logger.Info().Int("runs", len(runs)).Msg("deleted host runs")
+
+	inputs := make([]dispatcher.CancelInputV2, 0, len(runs))
+	for _, run := range runs {
+		if run.Status != db.HostRunStatusPending || !run.RunID.Valid {
+			continue
+		}
+		inputs = append(inputs, dispatcher.CancelInputV2{
+			OrgId:     run.OrgID,
+			Principal: config.DefaultConfig.AppName,
+			RunId:     run.RunID.UUID,
+		})
+	}
+
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	// Cancel failures are not retried; the runs time out on their own.
+	canceled, err := h.canceler.Cancel(ctx, inputs)
+	if err != nil {
+		instrumentation.PlaybookDispatcherRequestError()
+		logger.Error().Err(err).Msg("cannot cancel pending runs")
+		return nil
+	}
+
+	var count int
+	for _, c := range canceled {
+		if c.Code == http.StatusAccepted {
+			count++
+		} else {
+			logger.Warn().Str("run_id", c.RunId.String()).Int("code", c.Code).Msg("cannot cancel run")
+		}
+	}
+	instrumentation.RunsCanceled(count)
+	logger.Info().Int("runs", count).Msg("canceled pending runs")
+
+	return nil
 }
@@ -0,0 +1,407 @@
+package inventoryconsumer
+
+import (
+	"config-manager/infrastructure/persistence/dispatcher"
+	"config-manager/internal"
+	"config-manager/internal/consumer"
+	"config-manager/internal/db"
+	"config-manager/internal/reconcile"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/google/go-cmp/cmp"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	UNIXTime string = "1970-01-01T00:00:00Z"
+)
+
+var (
+	DSN  string
+	port uint32
+)
+
+func TestMain(m *testing.M) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	port = uint32(r.Int31n(10000-9876) + 9876)
+	DSN = fmt.Sprintf("host=localhost port=%v user=postgres password=postgres dbname=postgres sslmode=disable", port)
+
+	runtimedir, err := os.MkdirTemp("", "config-manager-internal-cmd-inventoryconsumer.")
+	if err != nil {
+		log.Fatalf("cannot make temp dir: %v", err)
+	}
+	postgres := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().Port(port).RuntimePath(runtimedir))
+
+	if err := postgres.Start(); err != nil {
+		log.Fatalf("failed to start database: %v", err)
+	}
+
+	code := m.Run()
+
+	if err := postgres.Stop(); err != nil {
+		log.Fatalf("failed to stop database: %v", err)
+	}
+
+	if err := os.RemoveAll(runtimedir); err != nil {
+		log.Fatalf("cannot remove temp dir: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+// fakeApplier records the hosts passed to ApplyProfileToHosts.
+type fakeApplier struct {
+	hosts []string
+}
+
+func (f *fakeApplier) ApplyProfileToHosts(ctx context.Context, profile db.Profile, hosts []internal.Host, principal string) ([]reconcile.Run, error) {
+	for _, host := range hosts {
+		f.hosts = append(f.hosts, host.ID)
+	}
+	return nil, nil
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       kafka.Message
+		want        []string
+	}{
+		{
+			description: "host with out of date configuration",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("created")}},
+				Value:   []byte(`{"type":"created","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{"rhc_client_id":"276c4685-fdfb-4172-930f-4148b8340c2e","rhc_config_state":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"}}}`),
+			},
+			want: []string{"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"},
+		},
+		{
+			description: "host with pending run of current profile",
+			seed: []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');
+			INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'pending');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("updated")}},
+				Value:   []byte(`{"type":"updated","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{"rhc_client_id":"276c4685-fdfb-4172-930f-4148b8340c2e","rhc_config_state":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"}}}`),
+			},
+			want: nil,
+		},
+		{
+			description: "host with failed run of current profile",
+			seed: []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');
+			INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'failure');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("updated")}},
+				Value:   []byte(`{"type":"updated","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{"rhc_client_id":"276c4685-fdfb-4172-930f-4148b8340c2e","rhc_config_state":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"}}}`),
+			},
+			want: []string{"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"},
+		},
+		{
+			description: "host with current configuration",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("updated")}},
+				Value:   []byte(`{"type":"updated","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{"rhc_client_id":"276c4685-fdfb-4172-930f-4148b8340c2e","rhc_config_state":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a"}}}`),
+			},
+			want: nil,
+		},
+		{
+			description: "inactive profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', FALSE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("created")}},
+				Value:   []byte(`{"type":"created","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{"rhc_client_id":"276c4685-fdfb-4172-930f-4148b8340c2e"}}}`),
+			},
+			want: nil,
+		},
+		{
+			description: "host not connected",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("created")}},
+				Value:   []byte(`{"type":"created","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{}}}`),
+			},
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			fake := &fakeApplier{}
+			h := &inventoryHandler{
+				profiles:  db.NewProfileRepository(database),
+				templates: db.NewTemplateRepository(database),
+				hostRuns:  db.NewHostRunRepository(database),
+				applier:   fake,
+			}
+
+			if err := h.handler(context.Background(), test.input); err != nil {
+				t.Fatalf("failed to handle message: %v", err)
+			}
+
+			if !cmp.Equal(fake.hosts, test.want) {
+				t.Errorf("%v", cmp.Diff(fake.hosts, test.want))
+			}
+		})
+	}
+}
+
+// fakeWriter records the messages passed to WriteMessages, or fails with err.
+type fakeWriter struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (f *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.messages = append(f.messages, msgs...)
+	return nil
+}
+
+func TestProcessDeadLetter(t *testing.T) {
+	tests := []struct {
+		description string
+		input       kafka.Message
+		want        int
+	}{
+		{
+			description: "malformed value",
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("created")}},
+				Value:   []byte(`{"type":`),
+			},
+			want: 1,
+		},
+		{
+			description: "missing event_type header",
+			input: kafka.Message{
+				Value: []byte(`{"type":"created","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{}}}`),
+			},
+			want: 1,
+		},
+		{
+			description: "invalid host",
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("created")}},
+				Value:   []byte(`{"type":"created","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","system_profile":{}}}`),
+			},
+			want: 1,
+		},
+		{
+			description: "unknown event type",
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("updated_delta")}},
+				Value:   []byte(`{"type":"updated_delta"}`),
+			},
+			want: 0,
+		},
+		{
+			description: "host not connected",
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("created")}},
+				Value:   []byte(`{"type":"created","host":{"id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","system_profile":{}}}`),
+			},
+			want: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fake := &fakeWriter{}
+			h := &inventoryHandler{deadLetters: fake}
+
+			if err := h.process(context.Background(), test.input); err != nil {
+				t.Fatalf("failed to process message: %v", err)
+			}
+
+			if len(fake.messages) != test.want {
+				t.Fatalf("%v != %v", len(fake.messages), test.want)
+			}
+
+			for _, msg := range fake.messages {
+				if string(msg.Value) != string(test.input.Value) {
+					t.Errorf("%s != %s", msg.Value, test.input.Value)
+				}
+			}
+		})
+	}
+}
+
+// fakeCommitter records the offsets passed to CommitMessages.
+type fakeCommitter struct {
+	offsets []int64
+}
+
+func (f *fakeCommitter) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		f.offsets = append(f.offsets, msg.Offset)
+	}
+	return nil
+}
+
+func TestConsume(t *testing.T) {
+	invalid := kafka.Message{Value: []byte(`{"type":`)}
+	unknown := kafka.Message{
+		Headers: []kafka.Header{{Key: "event_type", Value: []byte("updated_delta")}},
+		Value:   []byte(`{"type":"updated_delta"}`),
+	}
+
+	tests := []struct {
+		description string
+		input       []kafka.Message
+		deadLetter  error
+		want        []int64
+	}{
+		{
+			description: "handled messages",
+			input:       []kafka.Message{unknown, unknown},
+			want:        []int64{1, 2},
+		},
+		{
+			description: "dead-lettered message followed by handled messages",
+			input:       []kafka.Message{invalid, unknown, unknown},
+			want:        []int64{1, 2, 3},
+		},
+		{
+			description: "failed message followed by handled messages",
+			input:       []kafka.Message{invalid, unknown, unknown},
+			deadLetter:  errors.New("broker not available"),
+			want:        []int64{1, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			h := &inventoryHandler{deadLetters: &fakeWriter{err: test.deadLetter}}
+			committer := &fakeCommitter{}
+			offsets := consumer.NewOffsetTracker()
+
+			msgs := make([]kafka.Message, len(test.input))
+			for i, msg := range test.input {
+				msg.Offset = int64(i + 1)
+				msgs[i] = msg
+				offsets.Fetched(msg)
+			}
+
+			for _, msg := range msgs {
+				h.consume(context.Background(), msg, offsets, committer)
+			}
+
+			if !cmp.Equal(committer.offsets, test.want) {
+				t.Errorf("%v", cmp.Diff(committer.offsets, test.want))
+			}
+		})
+	}
+}
+
+// fakeCanceler records the run IDs passed to Cancel.
+type fakeCanceler struct {
+	runs []string
+}
+
+func (f *fakeCanceler) Cancel(ctx context.Context, inputs []dispatcher.CancelInputV2) ([]dispatcher.RunCanceled, error) {
+	canceled := make([]dispatcher.RunCanceled, 0, len(inputs))
+	for _, input := range inputs {
+		f.runs = append(f.runs, input.RunId.String())
+		canceled = append(canceled, dispatcher.RunCanceled{Code: 202, RunId: input.RunId})
+	}
+	return canceled, nil
+}
+
+func TestHandlerDelete(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       kafka.Message
+		want        []string
+	}{
+		{
+			description: "host with pending run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success'), ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '74368f32-4e6d-4ea2-9b8f-22dac89f9ae4', 'pending');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("delete")}},
+				Value:   []byte(`{"type":"delete","id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","timestamp":"` + UNIXTime + `"}`),
+			},
+			want: []string{"74368f32-4e6d-4ea2-9b8f-22dac89f9ae4"},
+		},
+		{
+			description: "host without runs",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `');`),
+			input: kafka.Message{
+				Headers: []kafka.Header{{Key: "event_type", Value: []byte("delete")}},
+				Value:   []byte(`{"type":"delete","id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606"}`),
+			},
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			hostRuns := db.NewHostRunRepository(database)
+			defer hostRuns.Close()
+
+			fake := &fakeCanceler{}
+			h := &inventoryHandler{hostRuns: hostRuns, canceler: fake}
+
+			if err := h.handler(context.Background(), test.input); err != nil {
+				t.Fatalf("failed to handle message: %v", err)
+			}
+
+			if !cmp.Equal(fake.runs, test.want) {
+				t.Errorf("%v", cmp.Diff(fake.runs, test.want))
+			}
+
+			if _, err := hostRuns.GetCurrentHostRun(context.Background(), "78606", "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%v != %v", err, sql.ErrNoRows)
+			}
+		})
+	}
+}
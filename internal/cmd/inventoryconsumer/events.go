@@ -0,0 +1,103 @@
+package inventoryconsumer
+
+import (
+	"config-manager/internal"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Event types of messages read off the inventory.events topic, as given by
+// the "event_type" header.
+const (
+	EventTypeCreated = "created"
+	EventTypeUpdated = "updated"
+	EventTypeDelete  = "delete"
+)
+
+// InventoryEvent represents a message read off the inventory.events
+// topic. Delete events identify the host by ID and OrgID instead of Host.
+type InventoryEvent struct {
+	Type             string            `json:"type"`
+	Timestamp        time.Time         `json:"timestamp"`
+	Host             internal.Host     `json:"host"`
+	PlatformMetadata *PlatformMetadata `json:"platform_metadata"`
+	Metadata         *EventMetadata    `json:"metadata"`
+	ID               string            `json:"id"`
+	OrgID            string            `json:"org_id"`
+	Account          string            `json:"account"`
+	InsightsID       string            `json:"insights_id"`
+	RequestID        string            `json:"request_id"`
+}
+
+// PlatformMetadata describes the upload that caused an inventory event.
+type PlatformMetadata struct {
+	RequestID   string `json:"request_id"`
+	ArchiveURL  string `json:"archive_url"`
+	B64Identity string `json:"b64_identity"`
+}
+
+// EventMetadata describes the request that caused an inventory event.
+type EventMetadata struct {
+	RequestID string `json:"request_id"`
+}
+
+//go:embed schemas
+var schemaFS embed.FS
+
+// schemas maps each known event type to the schema its messages are validated
+// against.
+var schemas = map[string]*openapi3.Schema{
+	EventTypeCreated: mustLoadSchema("host_event.json"),
+	EventTypeUpdated: mustLoadSchema("host_event.json"),
+	EventTypeDelete:  mustLoadSchema("delete_event.json"),
+}
+
+func mustLoadSchema(name string) *openapi3.Schema {
+	data, err := schemaFS.ReadFile(path.Join("schemas", name))
+	if err != nil {
+		panic(err)
+	}
+
+	var schema openapi3.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		panic(fmt.Errorf("cannot unmarshal schema %v: %w", name, err))
+	}
+
+	return &schema
+}
+
+// knownEventType reports whether messages of eventType can be parsed.
+func knownEventType(eventType string) bool {
+	_, ok := schemas[eventType]
+	return ok
+}
+
+// parseEvent validates data against the schema of eventType and unmarshals it.
+// eventType must be a known event type.
+func parseEvent(eventType string, data []byte) (*InventoryEvent, error) {
+	schema, ok := schemas[eventType]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type: %v", eventType)
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal inventory event: %w", err)
+	}
+
+	if err := schema.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		return nil, fmt.Errorf("cannot validate inventory event: %w", err)
+	}
+
+	event := &InventoryEvent{}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal inventory event: %w", err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,269 @@
+package inventoryconsumer
+
+import (
+	"config-manager/internal"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseEvent(t *testing.T) {
+	parseTime := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	timePtr := func(s string) *time.Time {
+		v := parseTime(s)
+		return &v
+	}
+	strPtr := func(s string) *string {
+		return &s
+	}
+
+	tests := []struct {
+		description string
+		input       struct {
+			eventType string
+			fixture   string
+		}
+		want      *InventoryEvent
+		wantError bool
+	}{
+		{
+			description: "created event",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeCreated,
+				fixture:   "created.json",
+			},
+			want: &InventoryEvent{
+				Type:      EventTypeCreated,
+				Timestamp: parseTime("2026-10-01T12:00:00Z"),
+				PlatformMetadata: &PlatformMetadata{
+					RequestID:   "b1a6e3f0-0c6e-4a5c-9a7e-3f2d1c0b9a87",
+					ArchiveURL:  "https://console.redhat.com/api/ingress/v1/download/b1a6e3f0",
+					B64Identity: "eyJpZGVudGl0eSI6IHsib3JnX2lkIjogIjc4NjA2In19",
+				},
+				Metadata: &EventMetadata{
+					RequestID: "b1a6e3f0-0c6e-4a5c-9a7e-3f2d1c0b9a87",
+				},
+				Host: internal.Host{
+					ID:                    "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
+					Account:               "10064",
+					OrgID:                 "78606",
+					DisplayName:           "web01.example.com",
+					FQDN:                  "web01.example.com",
+					InsightsID:            "0f4e1d2c-3b4a-5968-7a6b-8c9d0e1f2a3b",
+					SubscriptionManagerID: "276c4685-fdfb-4172-930f-4148b8340c2e",
+					BIOSUUID:              "4c4c4544-0042-3510-8056-b4c04f4b3232",
+					IPAddresses:           []string{"10.0.0.10"},
+					MACAddresses:          []string{"52:54:00:12:34:56"},
+					Reporter:              "puptoo",
+					Created:               timePtr("2026-10-01T11:59:00Z"),
+					Updated:               timePtr("2026-10-01T12:00:00Z"),
+					StaleTimestamp:        timePtr("2026-10-02T17:00:00Z"),
+					StaleWarningTimestamp: timePtr("2026-10-09T17:00:00Z"),
+					CulledTimestamp:       timePtr("2026-10-16T17:00:00Z"),
+					PerReporterStaleness: map[string]internal.ReporterStaleness{
+						"puptoo": {
+							LastCheckIn:      timePtr("2026-10-01T12:00:00Z"),
+							StaleTimestamp:   timePtr("2026-10-02T17:00:00Z"),
+							CheckInSucceeded: true,
+						},
+					},
+					Tags: []internal.Tag{
+						{Namespace: strPtr("insights-client"), Key: "env", Value: strPtr("prod")},
+						{Key: "web"},
+					},
+					Groups: []internal.Group{
+						{ID: "5f3e2d1c-0b9a-4876-9543-210fedcba987", Name: "web-servers"},
+					},
+					SystemProfile: internal.SystemProfile{
+						RHCID:                 "276c4685-fdfb-4172-930f-4148b8340c2e",
+						RHCState:              "3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+						OwnerID:               "a3f1c2e4-5b6d-4e7f-8091-a2b3c4d5e6f7",
+						HostType:              "edge",
+						Arch:                  "x86_64",
+						OSRelease:             "9.4",
+						InsightsClientVersion: "3.2.2",
+						OperatingSystem:       &internal.OperatingSystem{Name: "RHEL", Major: 9, Minor: 4},
+					},
+				},
+			},
+		},
+		{
+			description: "updated event with empty collections",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeUpdated,
+				fixture:   "updated.json",
+			},
+			want: &InventoryEvent{
+				Type:      EventTypeUpdated,
+				Timestamp: parseTime("2026-10-01T12:00:00Z"),
+				Host: internal.Host{
+					ID:                   "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
+					OrgID:                "78606",
+					DisplayName:          "web01.example.com",
+					PerReporterStaleness: map[string]internal.ReporterStaleness{},
+					Tags:                 []internal.Tag{},
+					Groups:               []internal.Group{},
+				},
+			},
+		},
+		{
+			description: "delete event",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeDelete,
+				fixture:   "delete.json",
+			},
+			want: &InventoryEvent{
+				Type:       EventTypeDelete,
+				Timestamp:  parseTime("2026-10-01T12:00:00Z"),
+				ID:         "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
+				OrgID:      "78606",
+				Account:    "10064",
+				InsightsID: "0f4e1d2c-3b4a-5968-7a6b-8c9d0e1f2a3b",
+				RequestID:  "b1a6e3f0-0c6e-4a5c-9a7e-3f2d1c0b9a87",
+				PlatformMetadata: &PlatformMetadata{
+					RequestID: "b1a6e3f0-0c6e-4a5c-9a7e-3f2d1c0b9a87",
+				},
+			},
+		},
+		{
+			description: "host missing org ID",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeCreated,
+				fixture:   "missing-org-id.json",
+			},
+			wantError: true,
+		},
+		{
+			description: "tag missing key",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeUpdated,
+				fixture:   "invalid-tags.json",
+			},
+			wantError: true,
+		},
+		{
+			description: "non-numeric operating system version",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeUpdated,
+				fixture:   "invalid-operating-system.json",
+			},
+			wantError: true,
+		},
+		{
+			description: "host ID is not a UUID",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeCreated,
+				fixture:   "invalid-host-id.json",
+			},
+			wantError: true,
+		},
+		{
+			description: "delete event missing host ID",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeDelete,
+				fixture:   "delete-missing-id.json",
+			},
+			wantError: true,
+		},
+		{
+			description: "delete event host ID is not a UUID",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeDelete,
+				fixture:   "delete-invalid-id.json",
+			},
+			wantError: true,
+		},
+		{
+			description: "body type does not match header",
+			input: struct {
+				eventType string
+				fixture   string
+			}{
+				eventType: EventTypeDelete,
+				fixture:   "mismatched-type.json",
+			},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "inventory-events", test.input.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parseEvent(test.input.eventType, data)
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestKnownEventType(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: EventTypeCreated, want: true},
+		{input: EventTypeUpdated, want: true},
+		{input: EventTypeDelete, want: true},
+		{input: "updated_delta", want: false},
+		{input: "", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := knownEventType(test.input); got != test.want {
+				t.Errorf("%v != %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package prune
+
+import (
+	"config-manager/internal/cmd"
+	"config-manager/internal/config"
+	"config-manager/internal/db"
+	"config-manager/internal/instrumentation"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/rs/zerolog/log"
+)
+
+// NewCommand creates the prune subcommand, which deletes profiles from the
+// database of deps.
+func NewCommand(deps *cmd.Dependencies) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "prune",
+		ShortHelp: "Delete old profiles from the history of each org",
+		LongHelp:  "Deletes the profiles of each org that are older than 'prune-keep-days' days and are not among its 'prune-keep-versions' newest profiles. The current profile of an org and profiles that host runs refer to are never deleted. Runs once, or every 'prune-interval' if it is set.",
+		Exec: func(ctx context.Context, args []string) error {
+			return run(ctx, deps)
+		},
+	}
+}
+
+// run prunes profiles once, or every prune-interval until ctx is cancelled.
+func run(ctx context.Context, deps *cmd.Dependencies) error {
+	log.Info().Str("command", "prune").Bool("dry_run", config.DefaultConfig.PruneDryRun).Msg("started pruning profiles")
+
+	profiles := db.NewProfileRepository(deps.DB)
+	defer profiles.Close()
+
+	for {
+		policy, err := retentionPolicy(config.DefaultConfig.PruneKeepDays, config.DefaultConfig.PruneKeepVersions, time.Now())
+		if err != nil {
+			return err
+		}
+
+		err = prune(ctx, profiles, policy, config.DefaultConfig.PruneBatchSize, config.DefaultConfig.PruneDryRun)
+		if config.DefaultConfig.PruneInterval <= 0 {
+			return err
+		}
+		if err != nil {
+			log.Error().Err(err).Str("command", "prune").Msg("cannot prune profiles")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(config.DefaultConfig.PruneInterval):
+		}
+	}
+}
+
+// retentionPolicy returns the policy that keeps the keepVersions newest
+// profiles of each org and the profiles created in the keepDays days before
+// now. Zero disables the corresponding rule, so that with both at zero only the
+// current profile of each org and the profiles that host runs refer to are
+// kept.
+func retentionPolicy(keepDays int, keepVersions int, now time.Time) (db.RetentionPolicy, error) {
+	if keepDays < 0 {
+		return db.RetentionPolicy{}, fmt.Errorf("cannot prune profiles: invalid prune-keep-days: %v", keepDays)
+	}
+	if keepVersions < 0 {
+		return db.RetentionPolicy{}, fmt.Errorf("cannot prune profiles: invalid prune-keep-versions: %v", keepVersions)
+	}
+
+	return db.RetentionPolicy{
+		KeepVersions: keepVersions,
+		KeepSince:    now.AddDate(0, 0, -keepDays),
+	}, nil
+}
+
+// profilePruner deletes the profiles that a retention policy does not keep.
+type profilePruner interface {
+	GetExpiredProfiles(ctx context.Context, policy db.RetentionPolicy) (expired []uuid.UUID, referenced int, err error)
+	DeleteProfiles(ctx context.Context, profileIDs []uuid.UUID) (int, error)
+}
+
+// prune deletes the profiles of repository that policy does not keep, at most
+// batchSize profiles at a time, until none is left or ctx is cancelled. The
+// expired profiles are selected once, when prune starts. If dryRun is true,
+// the profiles are counted but not deleted.
+func prune(ctx context.Context, repository profilePruner, policy db.RetentionPolicy, batchSize int, dryRun bool) error {
+	logger := log.With().Str("module", "prune").Int("keep_versions", policy.KeepVersions).Time("keep_since", policy.KeepSince).Bool("dry_run", dryRun).Logger()
+
+	if batchSize <= 0 {
+		return fmt.Errorf("cannot prune profiles: invalid batch size: %v", batchSize)
+	}
+
+	expired, referenced, err := repository.GetExpiredProfiles(ctx, policy)
+	if err != nil {
+		instrumentation.PruneProfilesError()
+		return fmt.Errorf("cannot get expired profiles: %w", err)
+	}
+	instrumentation.ProfilesPruneReferenced(referenced)
+	logger = logger.With().Int("expired", len(expired)).Int("referenced", referenced).Logger()
+
+	if dryRun {
+		instrumentation.ProfilesPruneDryRun(len(expired))
+		logger.Info().Msg("counted expired profiles")
+		return nil
+	}
+
+	var deleted int
+	for len(expired) > 0 && ctx.Err() == nil {
+		batch := expired[:min(batchSize, len(expired))]
+		expired = expired[len(batch):]
+
+		n, err := repository.DeleteProfiles(ctx, batch)
+		if err != nil {
+			instrumentation.PruneProfilesError()
+			return fmt.Errorf("cannot delete expired profiles: %w", err)
+		}
+		instrumentation.ProfilesPruned(n)
+		deleted += n
+		logger.Debug().Int("deleted", n).Msg("deleted batch of expired profiles")
+	}
+
+	logger.Info().Int("deleted", deleted).Msg("deleted expired profiles")
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package prune
+
+import (
+	"config-manager/internal/db"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+// fakeRepository serves expired profiles, recording the IDs of each call to
+// DeleteProfiles.
+type fakeRepository struct {
+	expired    []uuid.UUID
+	referenced int
+	err        error
+	batches    [][]uuid.UUID
+}
+
+func (r *fakeRepository) GetExpiredProfiles(ctx context.Context, policy db.RetentionPolicy) ([]uuid.UUID, int, error) {
+	if r.err != nil {
+		return nil, -1, r.err
+	}
+	return r.expired, r.referenced, nil
+}
+
+func (r *fakeRepository) DeleteProfiles(ctx context.Context, profileIDs []uuid.UUID) (int, error) {
+	if r.err != nil {
+		return -1, r.err
+	}
+	r.batches = append(r.batches, profileIDs)
+	return len(profileIDs), nil
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description  string
+		keepDays     int
+		keepVersions int
+		want         db.RetentionPolicy
+		wantError    bool
+	}{
+		{
+			description:  "days and versions",
+			keepDays:     90,
+			keepVersions: 50,
+			want:         db.RetentionPolicy{KeepVersions: 50, KeepSince: time.Date(2023, 12, 11, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			description:  "zero keeps only current profiles",
+			keepDays:     0,
+			keepVersions: 0,
+			want:         db.RetentionPolicy{KeepVersions: 0, KeepSince: now},
+		},
+		{
+			description:  "negative days",
+			keepDays:     -1,
+			keepVersions: 50,
+			wantError:    true,
+		},
+		{
+			description:  "negative versions",
+			keepDays:     90,
+			keepVersions: -1,
+			wantError:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := retentionPolicy(test.keepDays, test.keepVersions, now)
+
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ids := []uuid.UUID{
+		uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"),
+		uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
+		uuid.MustParse("f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11"),
+		uuid.MustParse("0f6ad7a5-7d1a-4c3b-9a0e-5b7c2d4e6f80"),
+		uuid.MustParse("9a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"),
+	}
+
+	type input struct {
+		expired   []uuid.UUID
+		err       error
+		batchSize int
+		dryRun    bool
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        [][]uuid.UUID
+		wantError   bool
+	}{
+		{
+			description: "batches",
+			input:       input{expired: ids, batchSize: 2},
+			want:        [][]uuid.UUID{ids[0:2], ids[2:4], ids[4:5]},
+		},
+		{
+			description: "full last batch",
+			input:       input{expired: ids[:4], batchSize: 2},
+			want:        [][]uuid.UUID{ids[0:2], ids[2:4]},
+		},
+		{
+			description: "nothing expired",
+			input:       input{expired: []uuid.UUID{}, batchSize: 2},
+		},
+		{
+			description: "dry run",
+			input:       input{expired: ids, batchSize: 2, dryRun: true},
+		},
+		{
+			description: "invalid batch size",
+			input:       input{expired: ids, batchSize: 0},
+			wantError:   true,
+		},
+		{
+			description: "database error",
+			input:       input{expired: ids, batchSize: 2, err: errors.New("connection refused")},
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fake := &fakeRepository{expired: test.input.expired, err: test.input.err}
+
+			policy := db.RetentionPolicy{KeepVersions: 10, KeepSince: time.Now()}
+			err := prune(context.Background(), fake, policy, test.input.batchSize, test.input.dryRun)
+
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(fake.batches, test.want) {
+				t.Errorf("%v", cmp.Diff(fake.batches, test.want))
+			}
+		})
+	}
+}
@@ -24,6 +24,8 @@ type Config struct {
 	CloudConnectorHost     flagvar.URL
 	CloudConnectorPSK      string
 	CloudConnectorTimeout  int
+	ConsumerMaxInFlight    int
+	ConsumerWorkers        int
 	DBHost                 string
 	DBName                 string
 	DBPass                 string
@@ -38,13 +40,18 @@ type Config struct {
 	InventoryTimeout       int
 	KafkaBrokers           flagvar.Strings
 	KafkaConsumerOffset    int64
+	KafkaDeadLetterTopic   string
+	KafkaDispatcherTopic   string
 	KafkaGroupID           string
 	KafkaInventoryTopic    string
 	KafkaPassword          string
+	KafkaReplaySince       flagvar.Time
+	KafkaRunDeadLetters    string
 	KafkaUsername          string
 	KafkaCAPath            string
 	KafkaSaslMechanism     string
 	KafkaSecurityProtocol  string
+	KafkaSysProfileTopic   string
 	KesselEnabled          bool
 	KesselURL              string
 	KesselAuthEnabled      bool
@@ -60,8 +67,16 @@ type Config struct {
 	MetricsPath            string
 	MetricsPort            int
 	Modules                flagvar.EnumSetCSV
+	PlaybookFiles          string
+	PlaybookHost           flagvar.URL
+	PruneBatchSize         int
+	PruneDryRun            bool
+	PruneInterval          time.Duration
+	PruneKeepDays          int
+	PruneKeepVersions      int
 	RbacURL                string
 	ServiceConfig          string
+	ShutdownTimeout        time.Duration
 	StaleEventDuration     time.Duration
 	URLPathPrefix          string
 	WebPort                int
@@ -82,6 +97,8 @@ var DefaultConfig Config = Config{
 	CloudConnectorHost:     flagvar.URL{Value: url.MustParse("http://cloud-connector:8080")},
 	CloudConnectorPSK:      "",
 	CloudConnectorTimeout:  10,
+	ConsumerMaxInFlight:    64,
+	ConsumerWorkers:        8,
 	DBHost:                 "localhost",
 	DBName:                 "insights",
 	DBPass:                 "insights",
@@ -95,14 +112,18 @@ var DefaultConfig Config = Config{
 	InventoryHost:          flagvar.URL{Value: url.MustParse("http://host-inventory-service:8000")},
 	InventoryTimeout:       10,
 	KafkaBrokers:           flagvar.Strings{Values: []string{"localhost:9094"}},
-	KafkaConsumerOffset:    0,
+	KafkaConsumerOffset:    -1,
+	KafkaDeadLetterTopic:   "platform.config-manager.inventory-dead-letter",
+	KafkaDispatcherTopic:   "platform.playbook-dispatcher.runs",
 	KafkaGroupID:           "config-manager",
 	KafkaInventoryTopic:    "platform.inventory.events",
 	KafkaPassword:          "",
+	KafkaRunDeadLetters:    "platform.config-manager.dispatcher-dead-letter",
 	KafkaUsername:          "",
 	KafkaCAPath:            "",
 	KafkaSaslMechanism:     "",
 	KafkaSecurityProtocol:  "",
+	KafkaSysProfileTopic:   "platform.inventory.system-profile",
 	KesselEnabled:          false,
 	KesselURL:              "localhost:9091",
 	KesselAuthEnabled:      false,
@@ -123,9 +144,17 @@ var DefaultConfig Config = Config{
 	}(),
 	MetricsPath:        "/metrics",
 	MetricsPort:        9000,
-	Modules:            flagvar.EnumSetCSV{Choices: []string{"http-api", "dispatcher-consumer", "inventory-consumer"}, Value: map[string]bool{}},
+	Modules:            flagvar.EnumSetCSV{Choices: []string{"http-api", "dispatcher-consumer", "inventory-consumer", "prune"}, Value: map[string]bool{}},
+	PlaybookFiles:      "",
+	PlaybookHost:       flagvar.URL{Value: url.MustParse("https://console.redhat.com")},
+	PruneBatchSize:     1000,
+	PruneDryRun:        false,
+	PruneInterval:      0,
+	PruneKeepDays:      90,
+	PruneKeepVersions:  50,
 	RbacURL:            "http://localhost:8000",
 	ServiceConfig:      `{"insights":"enabled","compliance_openscap":"enabled","remediations":"enabled"}`,
+	ShutdownTimeout:    30 * time.Second,
 	StaleEventDuration: 24 * time.Hour,
 	URLPathPrefix:      "api",
 	WebPort:            8081,
@@ -173,6 +202,14 @@ func init() {
 				switch requestedName {
 				case "platform.inventory.events":
 					DefaultConfig.KafkaInventoryTopic = topicConfig.Name
+				case "platform.config-manager.inventory-dead-letter":
+					DefaultConfig.KafkaDeadLetterTopic = topicConfig.Name
+				case "platform.config-manager.dispatcher-dead-letter":
+					DefaultConfig.KafkaRunDeadLetters = topicConfig.Name
+				case "platform.playbook-dispatcher.runs":
+					DefaultConfig.KafkaDispatcherTopic = topicConfig.Name
+				case "platform.inventory.system-profile":
+					DefaultConfig.KafkaSysProfileTopic = topicConfig.Name
 				}
 			}
 		}
@@ -209,6 +246,8 @@ func FlagSet(name string, errorHandling flag.ErrorHandling) *flag.FlagSet {
 	fs.Var(&DefaultConfig.CloudConnectorHost, "cloud-connector-host", fmt.Sprintf("hostname for the cloud-connector service (%v)", DefaultConfig.CloudConnectorHost.Help()))
 	fs.StringVar(&DefaultConfig.CloudConnectorPSK, "cloud-connector-psk", DefaultConfig.CloudConnectorPSK, "preshared key from config-manager")
 	fs.IntVar(&DefaultConfig.CloudConnectorTimeout, "cloud-connector-timeout", DefaultConfig.CloudConnectorTimeout, "number of seconds before timing out HTTP requests to cloud-connector")
+	fs.IntVar(&DefaultConfig.ConsumerMaxInFlight, "consumer-max-in-flight", DefaultConfig.ConsumerMaxInFlight, "maximum number of kafka messages queued or being handled by a consumer before fetching pauses")
+	fs.IntVar(&DefaultConfig.ConsumerWorkers, "consumer-workers", DefaultConfig.ConsumerWorkers, "number of workers handling kafka messages in each consumer")
 	fs.StringVar(&DefaultConfig.DBHost, "db-host", DefaultConfig.DBHost, "database host")
 	fs.StringVar(&DefaultConfig.DBName, "db-name", DefaultConfig.DBName, "database name")
 	fs.StringVar(&DefaultConfig.DBPass, "db-pass", DefaultConfig.DBPass, "database password")
@@ -222,14 +261,19 @@ func FlagSet(name string, errorHandling flag.ErrorHandling) *flag.FlagSet {
 	fs.Var(&DefaultConfig.InventoryHost, "inventory-host", fmt.Sprintf("hostname for the host-inventory service (%v)", DefaultConfig.InventoryHost.Help()))
 	fs.IntVar(&DefaultConfig.InventoryTimeout, "inventory-timeout", DefaultConfig.InventoryTimeout, "number of seconds before timing out HTTP requests to host-inventory")
 	fs.Var(&DefaultConfig.KafkaBrokers, "kafka-brokers", "kafka bootstrap broker addresses")
-	fs.Int64Var(&DefaultConfig.KafkaConsumerOffset, "kafka-consumer-offset", DefaultConfig.KafkaConsumerOffset, "kafka consumer offset")
+	fs.Int64Var(&DefaultConfig.KafkaConsumerOffset, "kafka-consumer-offset", DefaultConfig.KafkaConsumerOffset, "offset from which to consume partitions without a committed offset (-1 for the newest message, -2 for the oldest)")
+	fs.StringVar(&DefaultConfig.KafkaDeadLetterTopic, "kafka-dead-letter-topic", DefaultConfig.KafkaDeadLetterTopic, "topic to which inventory events that cannot be parsed or handled are written")
+	fs.StringVar(&DefaultConfig.KafkaDispatcherTopic, "kafka-dispatcher-topic", DefaultConfig.KafkaDispatcherTopic, "playbook-dispatcher runs topic name")
 	fs.StringVar(&DefaultConfig.KafkaGroupID, "kafka-group-id", DefaultConfig.KafkaGroupID, "kafka group ID")
 	fs.StringVar(&DefaultConfig.KafkaInventoryTopic, "kafka-inventory-topic", DefaultConfig.KafkaInventoryTopic, "host-inventory events topic name")
 	fs.StringVar(&DefaultConfig.KafkaPassword, "kafka-password", DefaultConfig.KafkaPassword, "managed kafka auth password")
+	fs.Var(&DefaultConfig.KafkaReplaySince, "kafka-replay-since", fmt.Sprintf("time from which the inventory consumer group reprocesses events (%v)", DefaultConfig.KafkaReplaySince.Help()))
+	fs.StringVar(&DefaultConfig.KafkaRunDeadLetters, "kafka-run-dead-letter-topic", DefaultConfig.KafkaRunDeadLetters, "topic to which playbook-dispatcher run events that cannot be parsed or recorded are written")
 	fs.StringVar(&DefaultConfig.KafkaUsername, "kafka-username", DefaultConfig.KafkaUsername, "managed kafka auth username")
 	fs.StringVar(&DefaultConfig.KafkaCAPath, "kafka-cacert-path", DefaultConfig.KafkaCAPath, "managed kafka cacert path")
 	fs.StringVar(&DefaultConfig.KafkaSaslMechanism, "kafka-sasl-mechanism", DefaultConfig.KafkaSaslMechanism, "managed kafka sasl mechanism")
 	fs.StringVar(&DefaultConfig.KafkaSecurityProtocol, "kafka-security-protocol", DefaultConfig.KafkaSecurityProtocol, "managed kafka security protocol")
+	fs.StringVar(&DefaultConfig.KafkaSysProfileTopic, "kafka-system-profile-topic", DefaultConfig.KafkaSysProfileTopic, "host-inventory system profile topic name")
 	fs.BoolVar(&DefaultConfig.KesselEnabled, "kessel-enabled", DefaultConfig.KesselEnabled, "enable authorization using Kessel")
 	fs.StringVar(&DefaultConfig.KesselURL, "kessel-url", DefaultConfig.KesselURL, "Kessel API URL")
 	fs.BoolVar(&DefaultConfig.KesselAuthEnabled, "kessel-auth-enabled", DefaultConfig.KesselAuthEnabled, "enable Kessel client authentication")
@@ -245,8 +289,16 @@ func FlagSet(name string, errorHandling flag.ErrorHandling) *flag.FlagSet {
 	fs.StringVar(&DefaultConfig.MetricsPath, "metrics-path", DefaultConfig.MetricsPath, "base path on which metrics HTTP server responds")
 	fs.IntVar(&DefaultConfig.MetricsPort, "metrics-port", DefaultConfig.MetricsPort, "port on which metrics HTTP server listens")
 	fs.Var(&DefaultConfig.Modules, "module", fmt.Sprintf("config-manager modules to execute (%v)", DefaultConfig.Modules.Help()))
+	fs.StringVar(&DefaultConfig.PlaybookFiles, "playbook-files", DefaultConfig.PlaybookFiles, "directory containing the setup and remove playbook of each service, overriding the playbooks embedded in the binary")
+	fs.Var(&DefaultConfig.PlaybookHost, "playbook-host", fmt.Sprintf("hostname from which connected hosts fetch configuration playbooks (%v)", DefaultConfig.PlaybookHost.Help()))
+	fs.IntVar(&DefaultConfig.PruneBatchSize, "prune-batch-size", DefaultConfig.PruneBatchSize, "maximum number of profiles deleted per transaction by the prune module")
+	fs.BoolVar(&DefaultConfig.PruneDryRun, "prune-dry-run", DefaultConfig.PruneDryRun, "count the profiles the prune module would delete without deleting them")
+	fs.DurationVar(&DefaultConfig.PruneInterval, "prune-interval", DefaultConfig.PruneInterval, "duration of time between runs of the prune module (0 to run once, which the prune module does not allow)")
+	fs.IntVar(&DefaultConfig.PruneKeepDays, "prune-keep-days", DefaultConfig.PruneKeepDays, "number of days during which profiles are kept by the prune module (0 to keep no profile for its age)")
+	fs.IntVar(&DefaultConfig.PruneKeepVersions, "prune-keep-versions", DefaultConfig.PruneKeepVersions, "number of most recent profiles of each org kept by the prune module (0 to keep only the current profile)")
 	fs.StringVar(&DefaultConfig.RbacURL, "rbac-url", DefaultConfig.RbacURL, "RBAC API base URL")
 	fs.StringVar(&DefaultConfig.ServiceConfig, "service-config", DefaultConfig.ServiceConfig, "default state configuration")
+	fs.DurationVar(&DefaultConfig.ShutdownTimeout, "shutdown-timeout", DefaultConfig.ShutdownTimeout, "duration of time to wait for in-flight requests and messages to finish during shutdown")
 	fs.DurationVar(&DefaultConfig.StaleEventDuration, "stale-event-duration", DefaultConfig.StaleEventDuration, "duration of time after which inventory events are discarded")
 	fs.IntVar(&DefaultConfig.WebPort, "web-port", DefaultConfig.WebPort, "port on which HTTP API server listens")
 	fs.StringVar(&DefaultConfig.URLPathPrefix, "url-path-prefix", DefaultConfig.URLPathPrefix, "generic prefix used in the URL path")
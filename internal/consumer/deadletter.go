@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageWriter writes messages to a kafka topic.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// DeadLetter writes msg to w, which writes to a dead-letter topic, along with
+// headers recording cause and where msg was read from.
+func DeadLetter(ctx context.Context, w MessageWriter, msg kafka.Message, cause error) error {
+	headers := append(msg.Headers[:len(msg.Headers):len(msg.Headers)],
+		kafka.Header{Key: "error", Value: []byte(cause.Error())},
+		kafka.Header{Key: "topic", Value: []byte(msg.Topic)},
+		kafka.Header{Key: "partition", Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: "offset", Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+	if err := w.WriteMessages(ctx, kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}); err != nil {
+		return fmt.Errorf("cannot write message to dead-letter topic: %w", err)
+	}
+
+	return nil
+}
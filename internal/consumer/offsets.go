@@ -0,0 +1,71 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageCommitter commits the offsets of kafka messages.
+type MessageCommitter interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// OffsetTracker determines which offsets are safe to commit when messages of
+// a partition are handled out of order. An offset is safe to commit once it
+// and every offset fetched before it on the same partition are done.
+type OffsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	pending []kafka.Message
+	done    map[int64]bool
+}
+
+// NewOffsetTracker returns an OffsetTracker with no fetched messages.
+func NewOffsetTracker() *OffsetTracker {
+	return &OffsetTracker{
+		partitions: make(map[int]*partitionOffsets),
+	}
+}
+
+// Fetched records that msg was fetched and is not yet done. Messages must be
+// recorded in the order they were fetched.
+func (t *OffsetTracker) Fetched(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[msg.Partition] = p
+	}
+	p.pending = append(p.pending, msg)
+}
+
+// Done records that msg is done. It returns the latest message of the
+// partition that can now be committed, and false if there is none.
+func (t *OffsetTracker) Done(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[msg.Offset] = true
+
+	var commit kafka.Message
+	var found bool
+	for len(p.pending) > 0 && p.done[p.pending[0].Offset] {
+		commit = p.pending[0]
+		found = true
+		delete(p.done, commit.Offset)
+		p.pending = p.pending[1:]
+	}
+
+	return commit, found
+}
@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	type done struct {
+		msg        kafka.Message
+		wantOK     bool
+		wantOffset int64
+	}
+
+	tests := []struct {
+		description string
+		fetched     []kafka.Message
+		done        []done
+	}{
+		{
+			description: "in order",
+			fetched:     []kafka.Message{{Offset: 1}, {Offset: 2}},
+			done: []done{
+				{msg: kafka.Message{Offset: 1}, wantOK: true, wantOffset: 1},
+				{msg: kafka.Message{Offset: 2}, wantOK: true, wantOffset: 2},
+			},
+		},
+		{
+			description: "out of order",
+			fetched:     []kafka.Message{{Offset: 1}, {Offset: 2}, {Offset: 3}},
+			done: []done{
+				{msg: kafka.Message{Offset: 3}, wantOK: false},
+				{msg: kafka.Message{Offset: 2}, wantOK: false},
+				{msg: kafka.Message{Offset: 1}, wantOK: true, wantOffset: 3},
+			},
+		},
+		{
+			description: "separate partitions",
+			fetched:     []kafka.Message{{Partition: 0, Offset: 1}, {Partition: 1, Offset: 1}},
+			done: []done{
+				{msg: kafka.Message{Partition: 1, Offset: 1}, wantOK: true, wantOffset: 1},
+				{msg: kafka.Message{Partition: 0, Offset: 1}, wantOK: true, wantOffset: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			tracker := NewOffsetTracker()
+			for _, msg := range test.fetched {
+				tracker.Fetched(msg)
+			}
+
+			for _, d := range test.done {
+				got, ok := tracker.Done(d.msg)
+				if ok != d.wantOK {
+					t.Fatalf("offset %v: %v != %v", d.msg.Offset, ok, d.wantOK)
+				}
+				if ok && got.Offset != d.wantOffset {
+					t.Errorf("offset %v: %v != %v", d.msg.Offset, got.Offset, d.wantOffset)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Package consumer contains the building blocks shared by the kafka consumers:
+// a bounded worker pool and the tracking of offsets that are safe to commit.
+package consumer
+
+import (
+	"config-manager/internal/instrumentation"
+	"config-manager/internal/util"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// WorkerPool handles messages on a fixed number of workers. Messages sharing a
+// key are always handled by the same worker, in the order they were
+// submitted. At most maxInFlight messages are queued or being handled at once;
+// Submit blocks until a slot is free.
+type WorkerPool struct {
+	name     string
+	queues   []chan kafka.Message
+	inFlight chan struct{}
+	handle   func(ctx context.Context, msg kafka.Message)
+	wg       sync.WaitGroup
+}
+
+// NewWorkerPool starts a WorkerPool of the given size that calls handle with
+// ctx for each submitted message. name identifies the consumer in metrics.
+func NewWorkerPool(ctx context.Context, name string, workers int, maxInFlight int, handle func(ctx context.Context, msg kafka.Message)) *WorkerPool {
+	workers = max(workers, 1)
+	maxInFlight = max(maxInFlight, 1)
+
+	p := &WorkerPool{
+		name:     name,
+		queues:   make([]chan kafka.Message, workers),
+		inFlight: make(chan struct{}, maxInFlight),
+		handle:   handle,
+	}
+
+	for i := range p.queues {
+		p.queues[i] = make(chan kafka.Message, maxInFlight)
+		p.wg.Add(1)
+		go p.work(ctx, p.queues[i])
+	}
+
+	return p
+}
+
+// Submit queues msg on the worker assigned to key. It blocks while the pool
+// is at its in-flight limit, returning ctx.Err() if ctx is cancelled first.
+func (p *WorkerPool) Submit(ctx context.Context, key string, msg kafka.Message) error {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	instrumentation.ConsumerMessageQueued(p.name)
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- msg
+
+	return nil
+}
+
+// Close stops accepting messages and waits up to timeout for queued messages
+// to be handled. It returns false if the workers did not finish in time.
+func (p *WorkerPool) Close(timeout time.Duration) bool {
+	for _, q := range p.queues {
+		close(q)
+	}
+
+	return util.WaitTimeout(&p.wg, timeout)
+}
+
+func (p *WorkerPool) work(ctx context.Context, queue <-chan kafka.Message) {
+	defer p.wg.Done()
+
+	for msg := range queue {
+		instrumentation.ConsumerMessageDequeued(p.name)
+
+		start := time.Now()
+		p.handle(ctx, msg)
+		instrumentation.ConsumerMessageHandled(p.name, time.Since(start))
+
+		<-p.inFlight
+	}
+}
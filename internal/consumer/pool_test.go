@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestWorkerPoolOrdering(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]int64{}
+
+	pool := NewWorkerPool(context.Background(), "test", 4, 8, func(ctx context.Context, msg kafka.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		got[string(msg.Key)] = append(got[string(msg.Key)], msg.Offset)
+	})
+
+	want := map[string][]int64{}
+	for i := int64(0); i < 100; i++ {
+		key := strconv.Itoa(int(i % 5))
+		want[key] = append(want[key], i)
+		if err := pool.Submit(context.Background(), key, kafka.Message{Key: []byte(key), Offset: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !pool.Close(time.Second) {
+		t.Fatal("timed out waiting for workers")
+	}
+
+	if !cmp.Equal(got, want) {
+		t.Errorf("%v", cmp.Diff(got, want))
+	}
+}
+
+func TestWorkerPoolInFlightLimit(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewWorkerPool(context.Background(), "test", 2, 2, func(ctx context.Context, msg kafka.Message) {
+		<-release
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := pool.Submit(context.Background(), strconv.Itoa(i), kafka.Message{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Submit(ctx, "2", kafka.Message{}); err != context.DeadlineExceeded {
+		t.Errorf("%v != %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	if err := pool.Submit(context.Background(), "2", kafka.Message{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !pool.Close(time.Second) {
+		t.Fatal("timed out waiting for workers")
+	}
+}
@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"config-manager/internal/db"
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// retryAttempts is the number of times an operation failing with a
+	// transient database error is attempted.
+	retryAttempts = 5
+
+	// retryBackoff is the delay before the first retry. It doubles on each
+	// subsequent retry.
+	retryBackoff = 200 * time.Millisecond
+)
+
+// Retry calls op until it succeeds, fails with an error that is not a
+// transient database error, or retryAttempts is reached.
+func Retry(ctx context.Context, op func() error) error {
+	backoff := retryBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op()
+		if err == nil || !db.IsTransient(err) || attempt == retryAttempts {
+			return err
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Dur("backoff", backoff).Msg("retrying after transient database error")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
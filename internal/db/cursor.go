@@ -0,0 +1,44 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor identifies a position in an org's profile history, which is ordered
+// by creation time and profile ID, newest first. Clients handle cursors as
+// opaque strings.
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ProfileID uuid.UUID `json:"profile_id"`
+}
+
+// CursorOf returns the cursor positioned at profile.
+func CursorOf(profile Profile) Cursor {
+	return Cursor{CreatedAt: profile.CreatedAt, ProfileID: profile.ID}
+}
+
+// String encodes the cursor as an opaque, URL-safe string.
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor encoded by Cursor.String. If s is not a valid
+// cursor, the returned error is a ParseError.
+func ParseCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ParseError{msg: "invalid cursor: " + s}
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ProfileID == uuid.Nil || c.CreatedAt.IsZero() {
+		return Cursor{}, ParseError{msg: "invalid cursor: " + s}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestParseCursor(t *testing.T) {
+	cursor := Cursor{
+		CreatedAt: time.Date(1970, 1, 2, 0, 0, 0, 0, time.UTC),
+		ProfileID: uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
+	}
+
+	tests := []struct {
+		description string
+		input       string
+		want        Cursor
+		wantError   error
+	}{
+		{
+			description: "round trip",
+			input:       cursor.String(),
+			want:        cursor,
+		},
+		{
+			description: "invalid base64",
+			input:       "!!!",
+			wantError:   ParseError{msg: "invalid cursor: !!!"},
+		},
+		{
+			description: "invalid JSON",
+			input:       "not-a-cursor",
+			wantError:   ParseError{msg: "invalid cursor: not-a-cursor"},
+		},
+		{
+			description: "missing profile ID",
+			input:       Cursor{CreatedAt: cursor.CreatedAt}.String(),
+			wantError:   ParseError{msg: "invalid cursor: " + Cursor{CreatedAt: cursor.CreatedAt}.String()},
+		},
+		{
+			description: "missing created_at",
+			input:       Cursor{ProfileID: cursor.ProfileID}.String(),
+			wantError:   ParseError{msg: "invalid cursor: " + Cursor{ProfileID: cursor.ProfileID}.String()},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseCursor(test.input)
+
+			if test.wantError != nil {
+				if !cmp.Equal(err, test.wantError, cmp.AllowUnexported(ParseError{})) {
+					t.Errorf("%#v != %#v", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -54,46 +57,83 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func TestInsertProfile(t *testing.T) {
+func TestInsertCurrentProfile(t *testing.T) {
 	tests := []struct {
 		description string
+		seed        []byte
 		input       Profile
-		want        error
+		previousID  uuid.UUID
+		wantError   error
 	}{
 		{
-			description: "profile with account ID and org ID",
-			input:       *NewProfile("1", "1", map[string]string{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}),
-			want:        nil,
+			description: "first profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '3', '4', '` + UNIXTime + `');`),
+			input:       *NewProfile("2", "1", map[string]string{"insights": "enabled"}),
+			previousID:  uuid.Nil,
 		},
 		{
-			description: "profile without account ID",
-			input:       *NewProfile("", "1", map[string]string{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}),
-			want:        nil,
+			description: "first profile without account ID",
+			input:       *NewProfile("2", "", map[string]string{"insights": "enabled"}),
+			previousID:  uuid.Nil,
 		},
 		{
-			description: "profile without org ID",
-			input:       *NewProfile("1", "", map[string]string{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}),
-			want:        nil,
+			description: "current profile unchanged",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input:       *NewProfile("2", "1", map[string]string{"insights": "enabled"}),
+			previousID:  uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+		},
+		{
+			description: "current profile changed",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', NOW());`),
+			input:       *NewProfile("2", "1", map[string]string{"insights": "enabled"}),
+			previousID:  uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+			wantError:   ErrProfileChanged,
+		},
+		{
+			description: "first profile inserted concurrently",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input:       *NewProfile("2", "1", map[string]string{"insights": "enabled"}),
+			previousID:  uuid.Nil,
+			wantError:   ErrProfileChanged,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := Open("pgx", DSN); err != nil {
+			db, err := Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := Close(); err != nil {
+				if err := db.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := Migrate(true); err != nil {
+			if err := Migrate(db, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := InsertProfile(test.input); err != test.want {
-				t.Errorf("got error: %v", err)
+			profiles := NewProfileRepository(db)
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			err = profiles.InsertCurrentProfile(context.Background(), test.input, test.previousID)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("%v != %v", err, test.wantError)
+			}
+			if err != nil {
+				return
+			}
+
+			got, err := profiles.GetCurrentProfile(context.Background(), "2")
+			if err != nil {
+				t.Fatalf("failed to get current profile: %v", err)
+			}
+			if got.ID != test.input.ID {
+				t.Errorf("%v != %v", got.ID, test.input.ID)
 			}
 		})
 	}
@@ -114,30 +154,48 @@ func TestGetCurrentProfile(t *testing.T) {
 				AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
 				OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
 				CreatedAt: time.Unix(0, 0),
+				State:     StateMap{},
+				Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
+			},
+		},
+		{
+			description: "profiles with the same creation time",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '` + UNIXTime + `'); INSERT INTO org_current_profile (org_id, profile_id) VALUES ('2', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf');`),
+			input:       "2",
+			want: &Profile{
+				ID:        uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
+				AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+				OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+				CreatedAt: time.Unix(0, 0),
+				State:     StateMap{},
+				Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
 			},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := Open("pgx", DSN); err != nil {
+			db, err := Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := Close(); err != nil {
+				if err := db.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := Migrate(true); err != nil {
+			if err := Migrate(db, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := SeedData(test.seed); err != nil {
+			profiles := NewProfileRepository(db)
+
+			if err := SeedData(db, test.seed); err != nil {
 				t.Fatalf("failed to seed database: %v", err)
 			}
 
-			got, err := GetCurrentProfile(test.input)
+			got, err := profiles.GetCurrentProfile(context.Background(), test.input)
 			if err != nil {
 				t.Fatalf("failed to get current profile: %v", err)
 			}
@@ -153,41 +211,97 @@ func TestGetProfile(t *testing.T) {
 	tests := []struct {
 		description string
 		seed        []byte
-		input       string
-		want        *Profile
+		input       struct {
+			orgID     string
+			profileID string
+		}
+		want      *Profile
+		wantError error
 	}{
 		{
-			seed:  []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
-			input: "84d3724c-1944-41d1-a12a-235eddca7771",
+			description: "profile in org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input: struct {
+				orgID     string
+				profileID string
+			}{
+				orgID:     "2",
+				profileID: "84d3724c-1944-41d1-a12a-235eddca7771",
+			},
 			want: &Profile{
 				ID:        uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
 				AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
 				OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
 				CreatedAt: time.Unix(0, 0),
+				State:     StateMap{},
+				Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
+			},
+		},
+		{
+			description: "restored profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, restored_from, principal, reason, source) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', 'torque', 'revert outage', 'restore');`),
+			input: struct {
+				orgID     string
+				profileID string
+			}{
+				orgID:     "2",
+				profileID: "84d3724c-1944-41d1-a12a-235eddca7771",
+			},
+			want: &Profile{
+				ID:           uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+				AccountID:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+				OrgID:        &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+				CreatedAt:    time.Unix(0, 0),
+				State:        StateMap{},
+				RestoredFrom: func() *uuid.UUID { id := uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"); return &id }(),
+				Principal:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "torque"}},
+				Reason:       &JSONNullString{NullString: sql.NullString{Valid: true, String: "revert outage"}},
+				Source:       &JSONNullString{NullString: sql.NullString{Valid: true, String: "restore"}},
 			},
 		},
+		{
+			description: "profile in another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input: struct {
+				orgID     string
+				profileID string
+			}{
+				orgID:     "3",
+				profileID: "84d3724c-1944-41d1-a12a-235eddca7771",
+			},
+			wantError: sql.ErrNoRows,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := Open("pgx", DSN); err != nil {
+			db, err := Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := Close(); err != nil {
+				if err := db.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := Migrate(true); err != nil {
+			if err := Migrate(db, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := SeedData(test.seed); err != nil {
+			profiles := NewProfileRepository(db)
+
+			if err := SeedData(db, test.seed); err != nil {
 				t.Fatalf("failed to seed database: %v", err)
 			}
 
-			got, err := GetProfile(test.input)
+			got, err := profiles.GetProfile(context.Background(), test.input.orgID, test.input.profileID)
+			if test.wantError != nil {
+				if !errors.Is(err, test.wantError) {
+					t.Errorf("%v != %v", err, test.wantError)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("failed to get profile: %v", err)
 			}
@@ -199,49 +313,186 @@ func TestGetProfile(t *testing.T) {
 	}
 }
 
+func TestGetPreviousProfile(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       string
+		want        uuid.UUID
+		wantError   error
+	}{
+		{
+			description: "profile with previous profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', NOW() - INTERVAL '1 day'), ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', NOW()), ('0c3bd5e4-6f49-4c6a-9a8b-4d1b1d0b7b52', '1', '3', NOW() - INTERVAL '1 hour');`),
+			input:       "b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
+			want:        uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
+		},
+		{
+			description: "first profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', NOW());`),
+			input:       "84d3724c-1944-41d1-a12a-235eddca7771",
+			wantError:   sql.ErrNoRows,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			profiles := NewProfileRepository(db)
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			got, err := profiles.GetPreviousProfile(context.Background(), "2", test.input)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("%v != %v", err, test.wantError)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.ID != test.want {
+				t.Errorf("%v != %v", got.ID, test.want)
+			}
+		})
+	}
+}
+
 func TestGetProfiles(t *testing.T) {
 	tests := []struct {
 		description string
 		seed        []byte
 		input       struct {
-			orgID   string
-			orderBy string
-			limit   int
-			offset  int
+			orgID  string
+			filter ProfileFilter
+			sort   []SortKey
+			limit  int
+			offset int
 		}
 		want []Profile
 	}{
 		{
-			seed: []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, insights, remediations, compliance) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '` + UNIXTime + `', FALSE, FALSE, FALSE), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '` + UNIXTime + `', TRUE, TRUE, TRUE);`),
+			seed: []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
 			input: struct {
-				orgID   string
-				orderBy string
-				limit   int
-				offset  int
+				orgID  string
+				filter ProfileFilter
+				sort   []SortKey
+				limit  int
+				offset int
 			}{
-				orgID:   "2",
-				orderBy: "",
-				limit:   -1,
-				offset:  -1,
+				orgID:  "2",
+				limit:  -1,
+				offset: -1,
 			},
 			want: []Profile{
 				{
-					ID:           uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"),
-					AccountID:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
-					OrgID:        &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
-					CreatedAt:    time.Unix(0, 0),
-					Insights:     false,
-					Remediations: false,
-					Compliance:   false,
+					ID:        uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"),
+					AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+					OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+					CreatedAt: time.Unix(0, 0),
+					State:     StateMap{"insights": "disabled", "remediations": "disabled", "compliance_openscap": "disabled"},
+					Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
 				},
 				{
-					ID:           uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
-					AccountID:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
-					OrgID:        &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
-					CreatedAt:    time.Unix(0, 0),
-					Insights:     true,
-					Remediations: true,
-					Compliance:   true,
+					ID:        uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
+					AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+					OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+					CreatedAt: time.Unix(0, 0),
+					State:     StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+					Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
+				},
+			},
+		},
+		{
+			description: "filtered and sorted",
+			seed: []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES
+				('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '1970-01-01 00:00:00+00', true, '{"insights":"disabled"}'),
+				('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '1970-01-02 00:00:00+00', true, '{}'),
+				('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '1', '2', '1970-01-03 00:00:00+00', false, '{"insights":"enabled"}'),
+				('0f6ad7a5-7d1a-4c3b-9a0e-5b7c2d4e6f80', '1', '2', '1970-01-04 00:00:00+00', true, '{"insights":"enabled"}'),
+				('9a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d', '1', '2', '1970-01-05 00:00:00+00', true, '{"insights":"enabled"}');`),
+			input: struct {
+				orgID  string
+				filter ProfileFilter
+				sort   []SortKey
+				limit  int
+				offset int
+			}{
+				orgID: "2",
+				filter: ProfileFilter{
+					CreatedBefore: &[]time.Time{time.Unix(4*86400, 0)}[0],
+					Insights:      &[]bool{true}[0],
+				},
+				sort:   []SortKey{{Field: "active", Descending: true}, {Field: "created_at", Descending: true}},
+				limit:  -1,
+				offset: -1,
+			},
+			want: []Profile{
+				{
+					ID:        uuid.MustParse("0f6ad7a5-7d1a-4c3b-9a0e-5b7c2d4e6f80"),
+					AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+					OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+					CreatedAt: time.Unix(3*86400, 0),
+					Active:    true,
+					State:     StateMap{"insights": "enabled"},
+					Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
+				},
+				{
+					ID:        uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"),
+					AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+					OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+					CreatedAt: time.Unix(86400, 0),
+					Active:    true,
+					State:     StateMap{},
+					Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
+				},
+				{
+					ID:        uuid.MustParse("f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11"),
+					AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+					OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+					CreatedAt: time.Unix(2*86400, 0),
+					State:     StateMap{"insights": "enabled"},
+					Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
+				},
+			},
+		},
+		{
+			description: "paginated",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '` + UNIXTime + `', '{}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '` + UNIXTime + `', '{}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '1', '2', '` + UNIXTime + `', '{}');`),
+			input: struct {
+				orgID  string
+				filter ProfileFilter
+				sort   []SortKey
+				limit  int
+				offset int
+			}{
+				orgID:  "2",
+				sort:   []SortKey{{Field: "created_at"}},
+				limit:  1,
+				offset: 1,
+			},
+			want: []Profile{
+				{
+					ID:        uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"),
+					AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "1"}},
+					OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+					CreatedAt: time.Unix(0, 0),
+					State:     StateMap{},
+					Source:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "admin"}},
 				},
 			},
 		},
@@ -249,24 +500,27 @@ func TestGetProfiles(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := Open("pgx", DSN); err != nil {
+			db, err := Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := Close(); err != nil {
+				if err := db.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := Migrate(true); err != nil {
+			if err := Migrate(db, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := SeedData(test.seed); err != nil {
+			profiles := NewProfileRepository(db)
+
+			if err := SeedData(db, test.seed); err != nil {
 				t.Fatalf("failed to seed database: %v", err)
 			}
 
-			got, err := GetProfiles(test.input.orgID, test.input.orderBy, test.input.limit, test.input.offset)
+			got, err := profiles.GetProfiles(context.Background(), test.input.orgID, test.input.filter, test.input.sort, test.input.limit, test.input.offset)
 			if err != nil {
 				t.Fatalf("failed to get profile: %v", err)
 			}
@@ -278,6 +532,86 @@ func TestGetProfiles(t *testing.T) {
 	}
 }
 
+func TestGetProfilesAfter(t *testing.T) {
+	db, err := Open("pgx", DSN)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close database: %v", err)
+		}
+	}()
+
+	if err := Migrate(db, true); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	profiles := NewProfileRepository(db)
+
+	seed := []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES
+		('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '1970-01-01 00:00:00+00', '{}'),
+		('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '1970-01-02 00:00:00+00', '{}'),
+		('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '1', '2', '1970-01-03 00:00:00+00', '{}'),
+		('0f6ad7a5-7d1a-4c3b-9a0e-5b7c2d4e6f80', '1', '2', '1970-01-04 00:00:00+00', '{}'),
+		('9a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d', '1', '2', '1970-01-05 00:00:00+00', '{}'),
+		('6d8f0e2a-1b3c-4d5e-8f7a-9b0c1d2e3f4a', '1', '3', '1970-01-06 00:00:00+00', '{}');`)
+	if err := SeedData(db, seed); err != nil {
+		t.Fatalf("failed to seed database: %v", err)
+	}
+
+	const limit = 2
+
+	// Walking the history by cursor must return the same pages as walking it
+	// by offset.
+	var after *Cursor
+	for offset := 0; ; offset += limit {
+		want, err := profiles.GetProfiles(context.Background(), "2", ProfileFilter{}, []SortKey{{Field: "created_at", Descending: true}}, limit, offset)
+		if err != nil {
+			t.Fatalf("failed to get profiles: %v", err)
+		}
+
+		got, err := profiles.GetProfilesAfter(context.Background(), "2", ProfileFilter{}, after, limit)
+		if err != nil {
+			t.Fatalf("failed to get profiles: %v", err)
+		}
+
+		if !cmp.Equal(got, want) {
+			t.Fatalf("offset %v: %v", offset, cmp.Diff(got, want))
+		}
+
+		if len(got) < limit {
+			break
+		}
+		cursor := CursorOf(got[len(got)-1])
+		after = &cursor
+	}
+
+	// Unlike offsets, a cursor is not shifted by profiles inserted after it
+	// was issued.
+	first, err := profiles.GetProfilesAfter(context.Background(), "2", ProfileFilter{}, nil, limit)
+	if err != nil {
+		t.Fatalf("failed to get profiles: %v", err)
+	}
+	if err := SeedData(db, []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('2b4d6f80-1a3c-4e5f-9b7d-0c2e4a6b8d9f', '1', '2', '1970-01-07 00:00:00+00', '{}');`)); err != nil {
+		t.Fatalf("failed to seed database: %v", err)
+	}
+	cursor := CursorOf(first[len(first)-1])
+	got, err := profiles.GetProfilesAfter(context.Background(), "2", ProfileFilter{}, &cursor, limit)
+	if err != nil {
+		t.Fatalf("failed to get profiles: %v", err)
+	}
+
+	var gotIDs []string
+	for _, profile := range got {
+		gotIDs = append(gotIDs, profile.ID.String())
+	}
+	wantIDs := []string{"f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11", "3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"}
+	if !cmp.Equal(gotIDs, wantIDs) {
+		t.Errorf("%v", cmp.Diff(gotIDs, wantIDs))
+	}
+}
+
 func TestCountProfiles(t *testing.T) {
 	tests := []struct {
 		description string
@@ -286,7 +620,7 @@ func TestCountProfiles(t *testing.T) {
 		want        int
 	}{
 		{
-			seed:  []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, insights, remediations, compliance) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '` + UNIXTime + `', FALSE, FALSE, FALSE), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '` + UNIXTime + `', TRUE, TRUE, TRUE);`),
+			seed:  []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
 			input: "2",
 			want:  2,
 		},
@@ -294,24 +628,27 @@ func TestCountProfiles(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := Open("pgx", DSN); err != nil {
+			db, err := Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := Close(); err != nil {
+				if err := db.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := Migrate(true); err != nil {
+			if err := Migrate(db, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := SeedData(test.seed); err != nil {
+			profiles := NewProfileRepository(db)
+
+			if err := SeedData(db, test.seed); err != nil {
 				t.Fatalf("failed to seed database: %v", err)
 			}
 
-			got, err := CountProfiles(test.input)
+			got, err := profiles.CountProfiles(context.Background(), test.input, ProfileFilter{})
 			if err != nil {
 				t.Fatalf("failed to get profile: %v", err)
 			}
@@ -323,93 +660,622 @@ func TestCountProfiles(t *testing.T) {
 	}
 }
 
-func TestParseOrderBy(t *testing.T) {
-	type orderBy struct {
-		column    string
-		direction string
+func TestInsertHostRun(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       HostRun
+	}{
+		{
+			description: "dispatched run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input: HostRun{
+				HostID:    uuid.MustParse("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"),
+				OrgID:     "2",
+				ProfileID: uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+				RunID:     uuid.NullUUID{Valid: true, UUID: uuid.MustParse("3d711f8b-77d0-4ed5-a5b5-1d282bf930c7")},
+				Status:    HostRunStatusPending,
+			},
+		},
+		{
+			description: "failed run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input: HostRun{
+				HostID:    uuid.MustParse("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"),
+				OrgID:     "2",
+				ProfileID: uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+				Status:    HostRunStatusFailure,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			hostRuns := NewHostRunRepository(db)
+			defer hostRuns.Close()
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			if err := hostRuns.InsertHostRun(context.Background(), test.input); err != nil {
+				t.Fatalf("failed to insert host run: %v", err)
+			}
+
+			got, err := hostRuns.GetCurrentHostRun(context.Background(), test.input.OrgID, test.input.HostID.String())
+			if err != nil {
+				t.Fatalf("failed to get host run: %v", err)
+			}
+
+			if !cmp.Equal(*got, test.input, cmpopts.IgnoreFields(HostRun{}, "CreatedAt", "UpdatedAt")) {
+				t.Errorf("%v", cmp.Diff(*got, test.input, cmpopts.IgnoreFields(HostRun{}, "CreatedAt", "UpdatedAt")))
+			}
+		})
 	}
+}
 
+func TestGetCurrentHostRun(t *testing.T) {
 	tests := []struct {
 		description string
-		input       string
-		want        orderBy
-		wantError   error
+		seed        []byte
+		input       struct {
+			orgID  string
+			hostID string
+		}
+		want      *HostRun
+		wantError error
 	}{
 		{
-			description: "empty input",
-			input:       "",
-			want: orderBy{
-				column:    "",
-				direction: "",
+			description: "most recent run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, created_at, updated_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'failure', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z'), ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '74368f32-4e6d-4ea2-9b8f-22dac89f9ae4', 'success', '1970-01-02T00:00:00Z', '1970-01-02T00:00:00Z');`),
+			input: struct {
+				orgID  string
+				hostID string
+			}{
+				orgID:  "2",
+				hostID: "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
+			},
+			want: &HostRun{
+				HostID:    uuid.MustParse("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"),
+				OrgID:     "2",
+				ProfileID: uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+				RunID:     uuid.NullUUID{Valid: true, UUID: uuid.MustParse("74368f32-4e6d-4ea2-9b8f-22dac89f9ae4")},
+				Status:    HostRunStatusSuccess,
+				CreatedAt: time.Unix(86400, 0),
+				UpdatedAt: time.Unix(86400, 0),
 			},
 		},
 		{
-			description: "only column",
-			input:       "created_at",
-			want: orderBy{
-				column:    "created_at",
-				direction: "",
+			description: "host in another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'pending');`),
+			input: struct {
+				orgID  string
+				hostID string
+			}{
+				orgID:  "3",
+				hostID: "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
 			},
+			wantError: sql.ErrNoRows,
 		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			hostRuns := NewHostRunRepository(db)
+			defer hostRuns.Close()
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			got, err := hostRuns.GetCurrentHostRun(context.Background(), test.input.orgID, test.input.hostID)
+			if test.wantError != nil {
+				if !errors.Is(err, test.wantError) {
+					t.Errorf("%v != %v", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to get host run: %v", err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestGetHostRunsForProfile(t *testing.T) {
+	seed := []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'), ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, status, created_at, updated_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', 'success', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z'), ('0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f', '2', '84d3724c-1944-41d1-a12a-235eddca7771', 'failure', '1970-01-02T00:00:00Z', '1970-01-02T00:00:00Z'), ('0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f', '2', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', 'pending', '1970-01-03T00:00:00Z', '1970-01-03T00:00:00Z');`)
+
+	tests := []struct {
+		description string
+		input       struct {
+			limit  int
+			offset int
+		}
+		want []string
+	}{
 		{
-			description: "empty direction",
-			input:       "created_at:",
-			want: orderBy{
-				column:    "created_at",
-				direction: "",
+			description: "all runs",
+			input: struct {
+				limit  int
+				offset int
+			}{limit: -1, offset: -1},
+			want: []string{"0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f", "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"},
+		},
+		{
+			description: "second page",
+			input: struct {
+				limit  int
+				offset int
+			}{limit: 1, offset: 1},
+			want: []string{"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			hostRuns := NewHostRunRepository(db)
+			defer hostRuns.Close()
+
+			if err := SeedData(db, seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			runs, err := hostRuns.GetHostRunsForProfile(context.Background(), "2", "84d3724c-1944-41d1-a12a-235eddca7771", test.input.limit, test.input.offset)
+			if err != nil {
+				t.Fatalf("failed to get host runs: %v", err)
+			}
+
+			got := []string{}
+			for _, run := range runs {
+				got = append(got, run.HostID.String())
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+
+			count, err := hostRuns.CountHostRunsForProfile(context.Background(), "2", "84d3724c-1944-41d1-a12a-235eddca7771")
+			if err != nil {
+				t.Fatalf("failed to count host runs: %v", err)
+			}
+			if count != 2 {
+				t.Errorf("%v != %v", count, 2)
+			}
+		})
+	}
+}
+
+func TestDeleteHostRuns(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       struct {
+			orgID  string
+			hostID string
+		}
+		want []string
+	}{
+		{
+			description: "host with runs",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, created_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success', '1970-01-01T00:00:00Z'), ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '74368f32-4e6d-4ea2-9b8f-22dac89f9ae4', 'pending', '1970-01-02T00:00:00Z'), ('9a76b28b-0e09-41c8-bf01-79d1bef72646', '2', '84d3724c-1944-41d1-a12a-235eddca7771', 'b9e3a5d1-4f0c-4c8e-9d3b-2a7f6e1c5d40', 'pending', '1970-01-02T00:00:00Z');`),
+			input: struct {
+				orgID  string
+				hostID string
+			}{
+				orgID:  "2",
+				hostID: "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
 			},
+			want: []string{"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7", "74368f32-4e6d-4ea2-9b8f-22dac89f9ae4"},
 		},
 		{
-			description: "column and direction",
-			input:       "last_updated:asc",
-			want: orderBy{
-				column:    "last_updated",
-				direction: "ASC",
+			description: "host in another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'pending');`),
+			input: struct {
+				orgID  string
+				hostID string
+			}{
+				orgID:  "3",
+				hostID: "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
 			},
+			want: nil,
 		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			hostRuns := NewHostRunRepository(db)
+			defer hostRuns.Close()
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			runs, err := hostRuns.DeleteHostRuns(context.Background(), test.input.orgID, test.input.hostID)
+			if err != nil {
+				t.Fatalf("failed to delete host runs: %v", err)
+			}
+
+			var got []string
+			for _, run := range runs {
+				got = append(got, run.RunID.UUID.String())
+			}
+			sort.Strings(got)
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+
+			if _, err := hostRuns.GetCurrentHostRun(context.Background(), test.input.orgID, test.input.hostID); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%v != %v", err, sql.ErrNoRows)
+			}
+		})
+	}
+}
+
+func TestUpdateHostRunStatus(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       string
+		want        *HostRun
+		wantStatus  string
+	}{
 		{
-			description: "multiple columns",
-			input:       "created_at,last_updated:desc",
-			want: orderBy{
-				column:    "(created_at, last_updated)",
-				direction: "DESC",
+			description: "pending run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'pending');`),
+			input:       "3d711f8b-77d0-4ed5-a5b5-1d282bf930c7",
+			want: &HostRun{
+				HostID:    uuid.MustParse("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60"),
+				OrgID:     "2",
+				ProfileID: uuid.MustParse("84d3724c-1944-41d1-a12a-235eddca7771"),
+				RunID:     uuid.NullUUID{UUID: uuid.MustParse("3d711f8b-77d0-4ed5-a5b5-1d282bf930c7"), Valid: true},
+				Status:    HostRunStatusSuccess,
 			},
+			wantStatus: HostRunStatusSuccess,
 		},
 		{
-			description: "invalid column name",
-			input:       "created_at;TRUNCATE",
-			wantError:   ParseError{msg: "invalid column field: created_at;TRUNCATE"},
+			description: "deleted run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, deleted_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', '84d3724c-1944-41d1-a12a-235eddca7771', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'pending', '` + UNIXTime + `');`),
+			input:       "3d711f8b-77d0-4ed5-a5b5-1d282bf930c7",
+			want:        nil,
+			wantStatus:  HostRunStatusPending,
 		},
 		{
-			description: "invalid direction",
-			input:       "created_at:;truncate",
-			wantError:   ParseError{msg: "invalid order direction: ;TRUNCATE"},
+			description: "unknown run",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '` + UNIXTime + `');`),
+			input:       "3d711f8b-77d0-4ed5-a5b5-1d282bf930c7",
+			want:        nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			hostRuns := NewHostRunRepository(db)
+			defer hostRuns.Close()
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			got, err := hostRuns.UpdateHostRunStatus(context.Background(), test.input, HostRunStatusSuccess)
+			if err != nil {
+				t.Fatalf("failed to update host run status: %v", err)
+			}
+
+			if !cmp.Equal(got, test.want, cmpopts.IgnoreFields(HostRun{}, "CreatedAt", "UpdatedAt")) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmpopts.IgnoreFields(HostRun{}, "CreatedAt", "UpdatedAt")))
+			}
+
+			var status string
+			if err := db.Get(&status, `SELECT COALESCE(MAX(status), '') FROM host_runs WHERE run_id = $1;`, test.input); err != nil {
+				t.Fatalf("failed to get host run status: %v", err)
+			}
+			if status != test.wantStatus {
+				t.Errorf("%v != %v", status, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestInsertTemplate(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       Template
+		want        string
+		wantError   bool
+	}{
+		{
+			description: "first default template",
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}, Default: true},
+			want:        "rhc",
 		},
 		{
-			description: "invalid format",
-			input:       "field_a:field_b:field_c",
-			wantError:   ParseError{msg: "cannot parse order: field_a:field_b:field_c"},
+			description: "replaces previous default",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('2', 'old', '{"insights":"disabled"}', TRUE);`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}, Default: true},
+			want:        "rhc",
+		},
+		{
+			description: "keeps previous default",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('2', 'old', '{"insights":"disabled"}', TRUE);`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}},
+			want:        "old",
+		},
+		{
+			description: "duplicate name",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('2', 'rhc', '{"insights":"disabled"}', TRUE);`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}},
+			wantError:   true,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			var err error
-			got := orderBy{}
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
 
-			got.column, got.direction, err = parseOrderBy(test.input)
+			templates := NewTemplateRepository(db)
+			defer templates.Close()
 
-			if test.wantError != nil {
-				if !cmp.Equal(err, test.wantError, cmpopts.EquateErrors()) {
-					t.Errorf("%#v != %#v", err, test.wantError)
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			err = templates.InsertTemplate(context.Background(), test.input)
+			if test.wantError {
+				if !errors.Is(err, ErrTemplateExists) {
+					t.Errorf("%v != %v", err, ErrTemplateExists)
 				}
-			} else {
-				if err != nil {
-					t.Fatal(err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to insert template: %v", err)
+			}
+
+			got, err := templates.GetDefaultTemplate(context.Background(), test.input.OrgID)
+			if err != nil {
+				t.Fatalf("failed to get default template: %v", err)
+			}
+
+			if got.Name != test.want {
+				t.Errorf("%v != %v", got.Name, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateTemplate(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       Template
+		updatedAt   time.Time
+		want        *Template
+		wantError   error
+	}{
+		{
+			description: "replaces state",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default, created_at) VALUES ('2', 'rhc', '{"insights":"disabled"}', TRUE, '` + UNIXTime + `');`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled", "remediations": "enabled"}, Default: true},
+			want:        &Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled", "remediations": "enabled"}, Default: true, CreatedAt: time.Unix(0, 0).UTC()},
+		},
+		{
+			description: "expected update time",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default, created_at, updated_at) VALUES ('2', 'rhc', '{"insights":"disabled"}', TRUE, '` + UNIXTime + `', '` + UNIXTime + `');`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}, Default: true},
+			updatedAt:   time.Unix(0, 0).UTC(),
+			want:        &Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}, Default: true, CreatedAt: time.Unix(0, 0).UTC()},
+		},
+		{
+			description: "template updated since",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default, created_at) VALUES ('2', 'rhc', '{"insights":"disabled"}', TRUE, '` + UNIXTime + `');`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}, Default: true},
+			updatedAt:   time.Unix(0, 0).UTC(),
+			wantError:   ErrTemplateChanged,
+		},
+		{
+			description: "template in another org",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('3', 'rhc', '{"insights":"disabled"}', TRUE);`),
+			input:       Template{OrgID: "2", Name: "rhc", State: StateMap{"insights": "enabled"}},
+			wantError:   sql.ErrNoRows,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
 				}
-				if !cmp.Equal(got, test.want, cmp.AllowUnexported(orderBy{})) {
-					t.Errorf("%#v != %#v", got, test.want)
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			templates := NewTemplateRepository(db)
+			defer templates.Close()
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			got, err := templates.UpdateTemplate(context.Background(), test.input, test.updatedAt)
+			if test.wantError != nil {
+				if !errors.Is(err, test.wantError) {
+					t.Errorf("%v != %v", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to update template: %v", err)
+			}
+
+			if !cmp.Equal(got, test.want, cmpopts.IgnoreFields(Template{}, "UpdatedAt")) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmpopts.IgnoreFields(Template{}, "UpdatedAt")))
+			}
+		})
+	}
+}
+
+func TestDeleteTemplate(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       struct {
+			orgID string
+			name  string
+		}
+		wantError error
+	}{
+		{
+			description: "existing template",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('2', 'rhc', '{"insights":"disabled"}', TRUE);`),
+			input: struct {
+				orgID string
+				name  string
+			}{
+				orgID: "2",
+				name:  "rhc",
+			},
+		},
+		{
+			description: "template in another org",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('3', 'rhc', '{"insights":"disabled"}', TRUE);`),
+			input: struct {
+				orgID string
+				name  string
+			}{
+				orgID: "2",
+				name:  "rhc",
+			},
+			wantError: sql.ErrNoRows,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			db, err := Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
 				}
+			}()
+
+			if err := Migrate(db, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			templates := NewTemplateRepository(db)
+			defer templates.Close()
+
+			if err := SeedData(db, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			err = templates.DeleteTemplate(context.Background(), test.input.orgID, test.input.name)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("%v != %v", err, test.wantError)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err := templates.GetTemplate(context.Background(), test.input.orgID, test.input.name); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%v != %v", err, sql.ErrNoRows)
 			}
 		})
 	}
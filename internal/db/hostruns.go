@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// HostRunRepository stores and retrieves the runs that apply profiles to
+// hosts. Its methods are safe for concurrent use.
+type HostRunRepository interface {
+	InsertHostRun(ctx context.Context, run HostRun) error
+	UpdateHostRunStatus(ctx context.Context, runID string, status string) (*HostRun, error)
+	DeleteHostRuns(ctx context.Context, orgID string, hostID string) ([]HostRun, error)
+	GetCurrentHostRun(ctx context.Context, orgID string, hostID string) (*HostRun, error)
+	GetHostRunsForProfile(ctx context.Context, orgID string, profileID string, limit int, offset int) ([]HostRun, error)
+	CountHostRunsForProfile(ctx context.Context, orgID string, profileID string) (int, error)
+}
+
+// SQLHostRunRepository is a HostRunRepository backed by a database.
+type SQLHostRunRepository struct {
+	db         *sqlx.DB
+	statements *statementCache
+}
+
+// NewHostRunRepository creates a SQLHostRunRepository that queries db.
+func NewHostRunRepository(db *sqlx.DB) *SQLHostRunRepository {
+	return &SQLHostRunRepository{
+		db:         db,
+		statements: newStatementCache(db),
+	}
+}
+
+// Close closes the prepared statements of the repository. It does not close
+// the database.
+func (r *SQLHostRunRepository) Close() error {
+	return r.statements.close()
+}
+
+// InsertHostRun creates a new record in the host_runs table from run.
+func (r *SQLHostRunRepository) InsertHostRun(ctx context.Context, run HostRun) error {
+	stmt, err := r.statements.prepare(ctx, `INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ($1, $2, $3, $4, $5);`)
+	if err != nil {
+		return fmt.Errorf("cannot prepare INSERT: %w", err)
+	}
+
+	_, err = stmt.ExecContext(ctx, run.HostID, run.OrgID, run.ProfileID, run.RunID, run.Status)
+	if err != nil {
+		return fmt.Errorf("cannot execute INSERT: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateHostRunStatus sets the status of the host run with the given run ID and
+// returns the updated host run. Tombstoned host runs are left untouched. If no
+// host run that is not tombstoned has the given run ID, it returns nil.
+func (r *SQLHostRunRepository) UpdateHostRunStatus(ctx context.Context, runID string, status string) (*HostRun, error) {
+	query := fmt.Sprintf("UPDATE host_runs SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE run_id = $2 AND deleted_at IS NULL RETURNING %v;", hostRunsFields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare UPDATE: %w", err)
+	}
+
+	var run HostRun
+	if err := stmt.GetContext(ctx, &run, status, runID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot execute UPDATE: %w", err)
+	}
+
+	return &run, nil
+}
+
+// DeleteHostRuns tombstones the host runs of the given host ID and org ID,
+// excluding them from subsequent queries, and returns the runs that were
+// tombstoned.
+func (r *SQLHostRunRepository) DeleteHostRuns(ctx context.Context, orgID string, hostID string) ([]HostRun, error) {
+	query := fmt.Sprintf("UPDATE host_runs SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND host_id = $2 AND deleted_at IS NULL RETURNING %v;", hostRunsFields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare UPDATE: %w", err)
+	}
+
+	runs := []HostRun{}
+	if err := stmt.SelectContext(ctx, &runs, orgID, hostID); err != nil {
+		return nil, fmt.Errorf("cannot execute UPDATE: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetCurrentHostRun retrieves the most recent host run for the given host ID
+// and org ID from the database. If the host has no runs, the returned error
+// wraps sql.ErrNoRows.
+func (r *SQLHostRunRepository) GetCurrentHostRun(ctx context.Context, orgID string, hostID string) (*HostRun, error) {
+	query := fmt.Sprintf("SELECT %v FROM host_runs WHERE org_id = $1 AND host_id = $2 AND deleted_at IS NULL ORDER BY created_at DESC LIMIT 1;", hostRunsFields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var run HostRun
+	if err := stmt.GetContext(ctx, &run, orgID, hostID); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return &run, nil
+}
+
+// GetHostRunsForProfile retrieves the host runs that applied the given profile
+// ID for the given org ID from the database, newest first.
+func (r *SQLHostRunRepository) GetHostRunsForProfile(ctx context.Context, orgID string, profileID string, limit int, offset int) ([]HostRun, error) {
+	query := fmt.Sprintf("SELECT %v FROM host_runs WHERE org_id = $1 AND profile_id = $2 AND deleted_at IS NULL ORDER BY created_at DESC", hostRunsFields)
+	args := []interface{}{orgID, profileID}
+
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if offset > 0 {
+		args = append(args, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	query += ";"
+
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	runs := []HostRun{}
+	if err := stmt.SelectContext(ctx, &runs, args...); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return runs, nil
+}
+
+// CountHostRunsForProfile returns a count of all host runs that applied the
+// given profile ID for the given org ID from the database.
+func (r *SQLHostRunRepository) CountHostRunsForProfile(ctx context.Context, orgID string, profileID string) (int, error) {
+	stmt, err := r.statements.prepare(ctx, "SELECT COUNT(*) FROM host_runs WHERE org_id = $1 AND profile_id = $2 AND deleted_at IS NULL;")
+	if err != nil {
+		return -1, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var count int
+	if err := stmt.GetContext(ctx, &count, orgID, profileID); err != nil {
+		return -1, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return count, nil
+}
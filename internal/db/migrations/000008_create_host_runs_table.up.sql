@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Create the host_runs table, recording each attempt to apply a profile to a
+-- host.
+CREATE TABLE IF NOT EXISTS host_runs (
+    host_id UUID NOT NULL,
+    org_id TEXT NOT NULL,
+    profile_id UUID NOT NULL REFERENCES profiles (profile_id),
+    run_id UUID UNIQUE,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS host_runs_org_id_host_id_idx ON host_runs (org_id, host_id);
+
+CREATE INDEX IF NOT EXISTS host_runs_org_id_profile_id_idx ON host_runs (org_id, profile_id);
+
+COMMIT;
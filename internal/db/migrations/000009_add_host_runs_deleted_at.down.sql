@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE host_runs DROP COLUMN IF EXISTS deleted_at;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Tombstone host runs of hosts deleted from inventory instead of removing them,
+-- preserving the history of each profile.
+ALTER TABLE host_runs ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+COMMIT;
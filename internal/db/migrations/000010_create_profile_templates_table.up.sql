@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Create the profile_templates table, recording the named state maps an org
+-- can use to seed its first profile.
+CREATE TABLE IF NOT EXISTS profile_templates (
+    org_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    state JSONB NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, name)
+);
+
+-- At most one template per org seeds the org's first profile.
+CREATE UNIQUE INDEX IF NOT EXISTS profile_templates_org_id_default_idx ON profile_templates (org_id) WHERE is_default;
+
+COMMIT;
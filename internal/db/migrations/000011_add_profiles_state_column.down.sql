@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE profiles ADD COLUMN insights BOOLEAN NOT NULL DEFAULT FALSE, ADD COLUMN remediations BOOLEAN NOT NULL DEFAULT FALSE, ADD COLUMN compliance BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Services missing from the state map are restored as disabled; services
+-- without a column are lost.
+UPDATE
+    profiles
+SET
+    insights = COALESCE(state ->> 'insights' = 'enabled', FALSE),
+    remediations = COALESCE(state ->> 'remediations' = 'enabled', FALSE),
+    compliance = COALESCE(state ->> 'compliance_openscap' = 'enabled', FALSE);
+
+ALTER TABLE profiles DROP COLUMN state;
+
+COMMIT;
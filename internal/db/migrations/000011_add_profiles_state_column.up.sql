@@ -0,0 +1,21 @@
+BEGIN;
+
+-- Store the state of each service as a "state map" instead of one column per
+-- service, so services can be added to the catalog without a migration.
+ALTER TABLE profiles ADD COLUMN state JSONB NOT NULL DEFAULT '{}';
+
+UPDATE
+    profiles
+SET
+    state = jsonb_build_object(
+        'insights',
+        CASE WHEN insights THEN 'enabled' ELSE 'disabled' END,
+        'remediations',
+        CASE WHEN remediations THEN 'enabled' ELSE 'disabled' END,
+        'compliance_openscap',
+        CASE WHEN compliance THEN 'enabled' ELSE 'disabled' END
+    );
+
+ALTER TABLE profiles DROP COLUMN insights, DROP COLUMN remediations, DROP COLUMN compliance;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE profiles DROP COLUMN restored_from;
+
+COMMIT;
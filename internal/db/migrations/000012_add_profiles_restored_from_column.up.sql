@@ -0,0 +1,7 @@
+BEGIN;
+
+-- restored_from is not a foreign key so that the profile it refers to can be
+-- deleted from the history.
+ALTER TABLE profiles ADD COLUMN restored_from UUID;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE profiles DROP COLUMN principal, DROP COLUMN reason, DROP COLUMN source;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- Record who made each profile change, why, and through which part of the
+-- service. Rows inserted directly into the database are attributed to an
+-- administrator; the source of earlier rows is unknown, except for restored
+-- profiles.
+ALTER TABLE profiles
+    ADD COLUMN principal TEXT,
+    ADD COLUMN reason TEXT,
+    ADD COLUMN source TEXT CHECK (source IN ('api', 'inventory-consumer', 'restore', 'admin'));
+
+UPDATE profiles SET source = 'restore' WHERE restored_from IS NOT NULL;
+
+ALTER TABLE profiles ALTER COLUMN source SET DEFAULT 'admin';
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS profiles_org_id_created_at_idx;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Serve the current profile and keyset pagination of an org's history from the
+-- index.
+CREATE INDEX IF NOT EXISTS profiles_org_id_created_at_idx ON profiles (org_id, created_at DESC, profile_id DESC);
+
+COMMIT;
@@ -0,0 +1,27 @@
+BEGIN;
+
+-- Create the org_current_profile table, pointing each org to its current
+-- profile. It is updated in the same transaction as the profile it points to
+-- is inserted.
+CREATE TABLE IF NOT EXISTS org_current_profile (
+    org_id TEXT PRIMARY KEY,
+    profile_id UUID NOT NULL REFERENCES profiles (profile_id),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Until now, the current profile of an org was its newest profile.
+INSERT INTO
+    org_current_profile (org_id, profile_id)
+SELECT DISTINCT ON (org_id)
+    org_id,
+    profile_id
+FROM
+    profiles
+WHERE
+    org_id IS NOT NULL
+ORDER BY
+    org_id,
+    created_at DESC,
+    profile_id DESC;
+
+COMMIT;
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RetentionPolicy selects the profiles kept in each org's history. A profile
+// is kept if it is one of the org's KeepVersions newest profiles, if it was
+// created after KeepSince or if it is the org's current profile.
+type RetentionPolicy struct {
+	KeepVersions int
+	KeepSince    time.Time
+}
+
+// expiredProfiles selects the profiles that are not kept by the retention
+// policy given by $1 (KeepVersions) and $2 (KeepSince), along with whether
+// host runs refer to them. Profiles referred to by host runs cannot be deleted.
+const expiredProfiles = `
+WITH ranked AS (
+    SELECT profile_id, org_id, created_at, row_number() OVER (PARTITION BY org_id ORDER BY created_at DESC, profile_id DESC) AS version
+    FROM profiles
+), expired AS (
+    SELECT ranked.profile_id, EXISTS (SELECT 1 FROM host_runs WHERE host_runs.org_id = ranked.org_id AND host_runs.profile_id = ranked.profile_id) AS referenced
+    FROM ranked
+    WHERE version > $1 AND created_at < $2 AND NOT EXISTS (SELECT 1 FROM org_current_profile WHERE org_current_profile.profile_id = ranked.profile_id)
+)`
+
+// GetExpiredProfiles returns the IDs of the profiles that are not kept by
+// policy and can be deleted, and the number of those that cannot be deleted
+// because host runs refer to them. The profiles of all orgs are ranked once,
+// so it is meant to be called once per prune run.
+func (r *SQLProfileRepository) GetExpiredProfiles(ctx context.Context, policy RetentionPolicy) (expired []uuid.UUID, referenced int, err error) {
+	query := expiredProfiles + ` SELECT profile_id, referenced FROM expired;`
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, -1, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var rows []struct {
+		ProfileID  uuid.UUID `db:"profile_id"`
+		Referenced bool      `db:"referenced"`
+	}
+	if err := stmt.SelectContext(ctx, &rows, policy.KeepVersions, policy.KeepSince); err != nil {
+		return nil, -1, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	expired = []uuid.UUID{}
+	for _, row := range rows {
+		if row.Referenced {
+			referenced++
+			continue
+		}
+		expired = append(expired, row.ProfileID)
+	}
+
+	return expired, referenced, nil
+}
+
+// DeleteProfiles deletes the profiles with the given IDs, except those that
+// host runs refer to and those that are the current profile of their org. It
+// returns the number of deleted profiles.
+func (r *SQLProfileRepository) DeleteProfiles(ctx context.Context, profileIDs []uuid.UUID) (int, error) {
+	ids := make([]string, 0, len(profileIDs))
+	for _, id := range profileIDs {
+		ids = append(ids, id.String())
+	}
+
+	stmt, err := r.statements.prepare(ctx, `DELETE FROM profiles WHERE profile_id = ANY($1::uuid[]) AND NOT EXISTS (SELECT 1 FROM host_runs WHERE host_runs.org_id = profiles.org_id AND host_runs.profile_id = profiles.profile_id) AND NOT EXISTS (SELECT 1 FROM org_current_profile WHERE org_current_profile.profile_id = profiles.profile_id);`)
+	if err != nil {
+		return -1, fmt.Errorf("cannot prepare DELETE: %w", err)
+	}
+
+	result, err := stmt.ExecContext(ctx, ids)
+	if err != nil {
+		return -1, fmt.Errorf("cannot execute DELETE: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("cannot get affected rows: %w", err)
+	}
+
+	return int(deleted), nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/uuid"
+)
+
+func TestDeleteProfiles(t *testing.T) {
+	db, err := Open("pgx", DSN)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close database: %v", err)
+		}
+	}()
+
+	if err := Migrate(db, true); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	profiles := NewProfileRepository(db)
+	defer profiles.Close()
+
+	// Org 2 has five old profiles: the first is referred to by a host run and
+	// the third is the current one. Org 3 has a single old profile and org 4
+	// has recent profiles only.
+	seed := []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES
+		('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '1', '2', '1970-01-01 00:00:00+00'),
+		('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '1', '2', '1970-01-02 00:00:00+00'),
+		('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '1', '2', '1970-01-03 00:00:00+00'),
+		('0f6ad7a5-7d1a-4c3b-9a0e-5b7c2d4e6f80', '1', '2', '1970-01-04 00:00:00+00'),
+		('9a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d', '1', '2', '1970-01-05 00:00:00+00'),
+		('6d8f0e2a-1b3c-4d5e-8f7a-9b0c1d2e3f4a', '1', '3', '1970-01-01 00:00:00+00'),
+		('2b4d6f80-1a3c-4e5f-9b7d-0c2e4a6b8d9f', '1', '4', NOW() - INTERVAL '2 days'),
+		('84d3724c-1944-41d1-a12a-235eddca7771', '1', '4', NOW() - INTERVAL '1 day');
+	INSERT INTO org_current_profile (org_id, profile_id) VALUES ('2', 'f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11');
+	INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '2', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success');`)
+	if err := SeedData(db, seed); err != nil {
+		t.Fatalf("failed to seed database: %v", err)
+	}
+
+	policy := RetentionPolicy{KeepVersions: 1, KeepSince: time.Now().AddDate(0, 0, -7)}
+
+	expired, referenced, err := profiles.GetExpiredProfiles(context.Background(), policy)
+	if err != nil {
+		t.Fatalf("failed to get expired profiles: %v", err)
+	}
+	wantExpired := []uuid.UUID{uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"), uuid.MustParse("0f6ad7a5-7d1a-4c3b-9a0e-5b7c2d4e6f80")}
+	sortIDs := cmpopts.SortSlices(func(a, b uuid.UUID) bool { return a.String() < b.String() })
+	if !cmp.Equal(expired, wantExpired, sortIDs) || referenced != 1 {
+		t.Errorf("(%v, %v) != (%v, 1)", expired, referenced, wantExpired)
+	}
+
+	// A host run referring to an expired profile after it was selected keeps
+	// it from being deleted.
+	if err := SeedData(db, []byte(`INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f61', '2', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c8', 'success');`)); err != nil {
+		t.Fatalf("failed to seed database: %v", err)
+	}
+
+	deleted, err := profiles.DeleteProfiles(context.Background(), expired)
+	if err != nil {
+		t.Fatalf("failed to delete expired profiles: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("%v != 1", deleted)
+	}
+
+	var got []string
+	if err := db.Select(&got, `SELECT profile_id::TEXT FROM profiles ORDER BY org_id, created_at;`); err != nil {
+		t.Fatalf("failed to select profiles: %v", err)
+	}
+	want := []string{
+		"b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
+		"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+		"f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11",
+		"9a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d",
+		"6d8f0e2a-1b3c-4d5e-8f7a-9b0c1d2e3f4a",
+		"2b4d6f80-1a3c-4e5f-9b7d-0c2e4a6b8d9f",
+		"84d3724c-1944-41d1-a12a-235eddca7771",
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("%v", cmp.Diff(got, want))
+	}
+
+	var runs int
+	if err := db.Get(&runs, `SELECT COUNT(*) FROM host_runs;`); err != nil {
+		t.Fatalf("failed to count host runs: %v", err)
+	}
+	if runs != 2 {
+		t.Errorf("%v != 2", runs)
+	}
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"config-manager/internal/catalog"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortableFields maps the fields profiles can be sorted by to their SQL
+// columns. Only these fields are accepted by ParseSort, so sort keys can be
+// spliced into queries safely.
+var sortableFields = map[string]string{
+	"id":         "profile_id",
+	"created_at": "created_at",
+	"active":     "active",
+	"principal":  "principal",
+	"source":     "source",
+}
+
+// SortKey is a field to sort profiles by and its direction.
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSort parses a comma-separated list of sort keys, each formatted as
+// "field" or "field:direction" where direction is "asc" (the default) or
+// "desc", for example "active:desc,created_at:asc". If s is not a valid list of
+// sort keys, the returned error is a ParseError.
+func ParseSort(s string) ([]SortKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var keys []SortKey
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(s, ",") {
+		field, direction, _ := strings.Cut(key, ":")
+		if _, ok := sortableFields[field]; !ok {
+			return nil, ParseError{msg: fmt.Sprintf("invalid sort field: %v", field)}
+		}
+		if seen[field] {
+			return nil, ParseError{msg: fmt.Sprintf("duplicate sort field: %v", field)}
+		}
+		seen[field] = true
+
+		switch strings.ToUpper(direction) {
+		case "", "ASC":
+			keys = append(keys, SortKey{Field: field})
+		case "DESC":
+			keys = append(keys, SortKey{Field: field, Descending: true})
+		default:
+			return nil, ParseError{msg: fmt.Sprintf("invalid order direction: %v", strings.ToUpper(direction))}
+		}
+	}
+
+	return keys, nil
+}
+
+// orderBy formats keys as an ORDER BY clause. Profiles that compare equal on
+// every key are ordered by profile ID, in the direction of the first key, so
+// that pages retrieved by offset do not overlap.
+func orderBy(keys []SortKey) string {
+	if len(keys) == 0 {
+		return ""
+	}
+
+	var columns []string
+	tiebreaker := true
+	for _, key := range keys {
+		column := sortableFields[key.Field]
+		if column == "profile_id" {
+			tiebreaker = false
+		}
+		if key.Descending {
+			column += " DESC"
+		}
+		columns = append(columns, column)
+	}
+	if tiebreaker {
+		if keys[0].Descending {
+			columns = append(columns, "profile_id DESC")
+		} else {
+			columns = append(columns, "profile_id")
+		}
+	}
+
+	return " ORDER BY " + strings.Join(columns, ", ")
+}
+
+// ProfileFilter restricts the profiles retrieved from an org's history. Nil
+// fields do not restrict the profiles.
+type ProfileFilter struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Active        *bool
+	Insights      *bool
+}
+
+// ParseProfileFilter parses the created_after, created_before (RFC 3339
+// timestamps), active and insights (booleans) query parameters. If a parameter
+// is not valid, the returned error is a ParseError.
+func ParseProfileFilter(query url.Values) (ProfileFilter, error) {
+	var filter ProfileFilter
+
+	parseTime := func(name string) (*time.Time, error) {
+		if !query.Has(name) {
+			return nil, nil
+		}
+		t, err := time.Parse(time.RFC3339, query.Get(name))
+		if err != nil {
+			return nil, ParseError{msg: fmt.Sprintf("invalid %v: %v", name, query.Get(name))}
+		}
+		return &t, nil
+	}
+
+	parseBool := func(name string) (*bool, error) {
+		if !query.Has(name) {
+			return nil, nil
+		}
+		b, err := strconv.ParseBool(query.Get(name))
+		if err != nil {
+			return nil, ParseError{msg: fmt.Sprintf("invalid %v: %v", name, query.Get(name))}
+		}
+		return &b, nil
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseTime("created_after"); err != nil {
+		return ProfileFilter{}, err
+	}
+	if filter.CreatedBefore, err = parseTime("created_before"); err != nil {
+		return ProfileFilter{}, err
+	}
+	if filter.Active, err = parseBool("active"); err != nil {
+		return ProfileFilter{}, err
+	}
+	if filter.Insights, err = parseBool("insights"); err != nil {
+		return ProfileFilter{}, err
+	}
+
+	return filter, nil
+}
+
+// where formats the filter as conditions to append to a WHERE clause. The
+// conditions' placeholders are numbered after the given query arguments, and
+// the returned arguments include both.
+func (f ProfileFilter) where(args []interface{}) (string, []interface{}) {
+	var conditions string
+	add := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions += " AND " + condition
+	}
+
+	if f.CreatedAfter != nil {
+		add("created_at > ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		add("created_at < ?", *f.CreatedBefore)
+	}
+	if f.Active != nil {
+		add("active = ?", *f.Active)
+	}
+	if f.Insights != nil {
+		// A profile without an insights value has the service's default value.
+		insights, _ := catalog.Lookup("insights")
+		value := "disabled"
+		if *f.Insights {
+			value = "enabled"
+		}
+		add("COALESCE(state->>'insights', ?) = ?", insights.Default, value)
+	}
+
+	return conditions, args
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		want        []SortKey
+		wantError   error
+	}{
+		{
+			description: "empty input",
+			input:       "",
+			want:        nil,
+		},
+		{
+			description: "only field",
+			input:       "created_at",
+			want:        []SortKey{{Field: "created_at"}},
+		},
+		{
+			description: "empty direction",
+			input:       "created_at:",
+			want:        []SortKey{{Field: "created_at"}},
+		},
+		{
+			description: "field and direction",
+			input:       "created_at:DESC",
+			want:        []SortKey{{Field: "created_at", Descending: true}},
+		},
+		{
+			description: "multiple fields",
+			input:       "active:desc,created_at:asc,id",
+			want: []SortKey{
+				{Field: "active", Descending: true},
+				{Field: "created_at"},
+				{Field: "id"},
+			},
+		},
+		{
+			description: "unknown field",
+			input:       "last_updated:asc",
+			wantError:   ParseError{msg: "invalid sort field: last_updated"},
+		},
+		{
+			description: "column name instead of field",
+			input:       "profile_id",
+			wantError:   ParseError{msg: "invalid sort field: profile_id"},
+		},
+		{
+			description: "invalid field",
+			input:       "created_at;TRUNCATE",
+			wantError:   ParseError{msg: "invalid sort field: created_at;TRUNCATE"},
+		},
+		{
+			description: "empty field",
+			input:       "created_at,",
+			wantError:   ParseError{msg: "invalid sort field: "},
+		},
+		{
+			description: "duplicate field",
+			input:       "created_at:asc,created_at:desc",
+			wantError:   ParseError{msg: "duplicate sort field: created_at"},
+		},
+		{
+			description: "invalid direction",
+			input:       "created_at:;truncate",
+			wantError:   ParseError{msg: "invalid order direction: ;TRUNCATE"},
+		},
+		{
+			description: "invalid format",
+			input:       "created_at:asc:desc",
+			wantError:   ParseError{msg: "invalid order direction: ASC:DESC"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseSort(test.input)
+
+			if test.wantError != nil {
+				if !cmp.Equal(err, test.wantError, cmpopts.EquateErrors()) {
+					t.Errorf("%#v != %#v", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		description string
+		input       []SortKey
+		want        string
+	}{
+		{
+			description: "no keys",
+			input:       nil,
+			want:        "",
+		},
+		{
+			description: "descending",
+			input:       []SortKey{{Field: "created_at", Descending: true}},
+			want:        " ORDER BY created_at DESC, profile_id DESC",
+		},
+		{
+			description: "mixed directions",
+			input:       []SortKey{{Field: "active"}, {Field: "created_at", Descending: true}},
+			want:        " ORDER BY active, created_at DESC, profile_id",
+		},
+		{
+			description: "sorted by id",
+			input:       []SortKey{{Field: "id", Descending: true}, {Field: "created_at"}},
+			want:        " ORDER BY profile_id DESC, created_at",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := orderBy(test.input)
+
+			if got != test.want {
+				t.Errorf("%q != %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseProfileFilter(t *testing.T) {
+	createdAfter := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	createdBefore := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	active := true
+	insights := false
+
+	tests := []struct {
+		description string
+		input       string
+		want        ProfileFilter
+		wantError   error
+	}{
+		{
+			description: "no filters",
+			input:       "limit=10",
+			want:        ProfileFilter{},
+		},
+		{
+			description: "all filters",
+			input:       "created_after=2024-01-02T03:04:05Z&created_before=2024-02-03T04:05:06Z&active=true&insights=false",
+			want: ProfileFilter{
+				CreatedAfter:  &createdAfter,
+				CreatedBefore: &createdBefore,
+				Active:        &active,
+				Insights:      &insights,
+			},
+		},
+		{
+			description: "invalid created_after",
+			input:       "created_after=yesterday",
+			wantError:   ParseError{msg: "invalid created_after: yesterday"},
+		},
+		{
+			description: "invalid created_before",
+			input:       "created_before=2024-01-02",
+			wantError:   ParseError{msg: "invalid created_before: 2024-01-02"},
+		},
+		{
+			description: "invalid active",
+			input:       "active=sometimes",
+			wantError:   ParseError{msg: "invalid active: sometimes"},
+		},
+		{
+			description: "empty insights",
+			input:       "insights=",
+			wantError:   ParseError{msg: "invalid insights: "},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			query, err := url.ParseQuery(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParseProfileFilter(query)
+
+			if test.wantError != nil {
+				if !cmp.Equal(err, test.wantError, cmpopts.EquateErrors()) {
+					t.Errorf("%#v != %#v", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestProfileFilterWhere(t *testing.T) {
+	createdAfter := time.Unix(0, 0)
+	active := false
+	insights := true
+
+	tests := []struct {
+		description string
+		input       ProfileFilter
+		wantWhere   string
+		wantArgs    []interface{}
+	}{
+		{
+			description: "no filters",
+			input:       ProfileFilter{},
+			wantWhere:   "",
+			wantArgs:    []interface{}{"2"},
+		},
+		{
+			description: "filters",
+			input:       ProfileFilter{CreatedAfter: &createdAfter, Active: &active, Insights: &insights},
+			wantWhere:   " AND created_at > $2 AND active = $3 AND COALESCE(state->>'insights', $4) = $5",
+			wantArgs:    []interface{}{"2", createdAfter, false, "enabled", "enabled"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			gotWhere, gotArgs := test.input.where([]interface{}{"2"})
+
+			if gotWhere != test.wantWhere {
+				t.Errorf("%q != %q", gotWhere, test.wantWhere)
+			}
+			if !cmp.Equal(gotArgs, test.wantArgs) {
+				t.Errorf("%v", cmp.Diff(gotArgs, test.wantArgs))
+			}
+		})
+	}
+}
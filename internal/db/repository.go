@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ProfileRepository stores and retrieves the profiles of orgs. Its methods are
+// safe for concurrent use.
+type ProfileRepository interface {
+	InsertCurrentProfile(ctx context.Context, profile Profile, previousID uuid.UUID) error
+	GetCurrentProfile(ctx context.Context, orgID string) (*Profile, error)
+	GetOrInsertCurrentProfile(ctx context.Context, orgID string, newProfile *Profile) (*Profile, error)
+	GetProfile(ctx context.Context, orgID string, profileID string) (*Profile, error)
+	GetPreviousProfile(ctx context.Context, orgID string, profileID string) (*Profile, error)
+	GetProfiles(ctx context.Context, orgID string, filter ProfileFilter, sort []SortKey, limit int, offset int) ([]Profile, error)
+	GetProfilesAfter(ctx context.Context, orgID string, filter ProfileFilter, after *Cursor, limit int) ([]Profile, error)
+	CountProfiles(ctx context.Context, orgID string, filter ProfileFilter) (int, error)
+}
+
+// SQLProfileRepository is a ProfileRepository backed by a database.
+type SQLProfileRepository struct {
+	db         *sqlx.DB
+	statements *statementCache
+}
+
+// NewProfileRepository creates a SQLProfileRepository that queries db.
+func NewProfileRepository(db *sqlx.DB) *SQLProfileRepository {
+	return &SQLProfileRepository{
+		db:         db,
+		statements: newStatementCache(db),
+	}
+}
+
+// Close closes the prepared statements of the repository. It does not close
+// the database.
+func (r *SQLProfileRepository) Close() error {
+	return r.statements.close()
+}
+
+// statementCache prepares statements on first use and caches them by query. It
+// is safe for concurrent use.
+type statementCache struct {
+	db         *sqlx.DB
+	mu         sync.RWMutex
+	statements map[string]*sqlx.Stmt
+}
+
+func newStatementCache(db *sqlx.DB) *statementCache {
+	return &statementCache{
+		db:         db,
+		statements: make(map[string]*sqlx.Stmt),
+	}
+}
+
+// prepare returns the cached prepared statement for query, preparing it if
+// there is none.
+func (c *statementCache) prepare(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	c.mu.RLock()
+	stmt, has := c.statements[query]
+	c.mu.RUnlock()
+	if has {
+		return stmt, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stmt, has := c.statements[query]; has {
+		return stmt, nil
+	}
+	stmt, err := c.db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare statement: %w", err)
+	}
+	c.statements[query] = stmt
+
+	return stmt, nil
+}
+
+// close closes and removes all cached statements.
+func (c *statementCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for query, stmt := range c.statements {
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+		delete(c.statements, query)
+	}
+
+	return nil
+}
+
+// ErrProfileChanged is wrapped by the error returned by InsertCurrentProfile
+// when the org's current profile is not the expected one.
+var ErrProfileChanged = errors.New("current profile changed")
+
+// InsertCurrentProfile inserts profile as the current profile of its org,
+// provided the org's current profile is the one with ID previousID, or the org
+// has no current profile if previousID is uuid.Nil. If the current profile has
+// changed, the returned error wraps ErrProfileChanged and profile is not
+// inserted.
+func (r *SQLProfileRepository) InsertCurrentProfile(ctx context.Context, profile Profile, previousID uuid.UUID) error {
+	orgID := JSONNullStringSafeValue(profile.OrgID)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The profile must be newer than the current one even if this
+	// transaction began before the current one was inserted.
+	if _, err := tx.ExecContext(ctx, `INSERT INTO profiles (profile_id, account_id, org_id, state, active, restored_from, principal, reason, source, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, clock_timestamp());`, profile.ID, profile.AccountID, profile.OrgID, profile.State, profile.Active, profile.RestoredFrom, profile.Principal, profile.Reason, profile.Source); err != nil {
+		return fmt.Errorf("cannot execute INSERT: %w", err)
+	}
+
+	// A concurrent transaction changing the same org's current profile holds
+	// the row (or its unique key) until it ends, after which the condition is
+	// evaluated against the row it committed.
+	var result sql.Result
+	if previousID == uuid.Nil {
+		result, err = tx.ExecContext(ctx, `INSERT INTO org_current_profile (org_id, profile_id) VALUES ($1, $2) ON CONFLICT (org_id) DO NOTHING;`, orgID, profile.ID)
+	} else {
+		result, err = tx.ExecContext(ctx, `UPDATE org_current_profile SET profile_id = $2, updated_at = clock_timestamp() WHERE org_id = $1 AND profile_id = $3;`, orgID, profile.ID, previousID)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot update current profile: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("cannot update current profile: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: current profile is not %v", ErrProfileChanged, previousID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetCurrentProfile retrieves the current profile for the given org ID from
+// the database. If the org has no current profile, the returned error wraps
+// sql.ErrNoRows.
+func (r *SQLProfileRepository) GetCurrentProfile(ctx context.Context, orgID string) (*Profile, error) {
+	query := fmt.Sprintf("SELECT %v FROM profiles WHERE profile_id = (SELECT profile_id FROM org_current_profile WHERE org_id = $1);", fields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var profile Profile
+	if err := stmt.GetContext(ctx, &profile, orgID); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// GetOrInsertCurrentProfile attempts to retrieve the current profile for the
+// given org ID. If the org has no current profile, newProfile is inserted as
+// its current profile. Concurrent calls for the same org insert at most one
+// profile; the others return the profile inserted by the first.
+func (r *SQLProfileRepository) GetOrInsertCurrentProfile(ctx context.Context, orgID string, newProfile *Profile) (*Profile, error) {
+	profile, err := r.GetCurrentProfile(ctx, orgID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return profile, err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO profiles (profile_id, account_id, org_id, state, active, principal, reason, source) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`, newProfile.ID, newProfile.AccountID, newProfile.OrgID, newProfile.State, newProfile.Active, newProfile.Principal, newProfile.Reason, newProfile.Source); err != nil {
+		return nil, fmt.Errorf("cannot execute INSERT: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO org_current_profile (org_id, profile_id) VALUES ($1, $2) ON CONFLICT (org_id) DO NOTHING;`, orgID, newProfile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute INSERT: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute INSERT: %w", err)
+	}
+
+	// If another call inserted the org's current profile first, newProfile
+	// is discarded along with the transaction.
+	if n == 1 {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("cannot commit transaction: %w", err)
+		}
+	} else if err := tx.Rollback(); err != nil {
+		return nil, fmt.Errorf("cannot roll back transaction: %w", err)
+	}
+
+	return r.GetCurrentProfile(ctx, orgID)
+}
+
+// GetProfile retrieves the profile for the given profile ID from the database,
+// provided it belongs to the given org ID. If no such profile exists, the
+// returned error wraps sql.ErrNoRows.
+func (r *SQLProfileRepository) GetProfile(ctx context.Context, orgID string, profileID string) (*Profile, error) {
+	query := fmt.Sprintf("SELECT %v FROM profiles WHERE org_id = $1 AND profile_id = $2;", fields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var profile Profile
+	if err := stmt.GetContext(ctx, &profile, orgID, profileID); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// GetPreviousProfile retrieves the profile that preceded the profile with the
+// given profile ID in the given org's history. If the profile does not exist or
+// is the org's first profile, the returned error wraps sql.ErrNoRows.
+func (r *SQLProfileRepository) GetPreviousProfile(ctx context.Context, orgID string, profileID string) (*Profile, error) {
+	query := fmt.Sprintf("SELECT %v FROM profiles WHERE org_id = $1 AND (created_at, profile_id) < (SELECT created_at, profile_id FROM profiles WHERE org_id = $1 AND profile_id = $2) ORDER BY created_at DESC, profile_id DESC LIMIT 1;", fields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var profile Profile
+	if err := stmt.GetContext(ctx, &profile, orgID, profileID); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// GetProfiles retrieves the profiles for the given org ID that match filter
+// from the database, sorted by the given keys.
+func (r *SQLProfileRepository) GetProfiles(ctx context.Context, orgID string, filter ProfileFilter, sort []SortKey, limit int, offset int) ([]Profile, error) {
+	conditions, args := filter.where([]interface{}{orgID})
+
+	query := fmt.Sprintf("SELECT %v FROM profiles WHERE org_id = $1%v%v", fields, conditions, orderBy(sort))
+
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if offset > 0 {
+		args = append(args, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	query += ";"
+
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	profiles := []Profile{}
+	if err := stmt.SelectContext(ctx, &profiles, args...); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// GetProfilesAfter retrieves at most limit profiles for the given org ID that
+// match filter from the database, newest first, starting after the position of
+// after. If after is nil, profiles are retrieved from the newest one.
+func (r *SQLProfileRepository) GetProfilesAfter(ctx context.Context, orgID string, filter ProfileFilter, after *Cursor, limit int) ([]Profile, error) {
+	// The first page and the following ones use separate statements, so the
+	// planner can use the (org_id, created_at, profile_id) index for both.
+	args := []interface{}{orgID, limit}
+	position := ""
+	if after != nil {
+		args = append(args, after.CreatedAt, after.ProfileID)
+		position = " AND (created_at, profile_id) < ($3, $4)"
+	}
+
+	conditions, args := filter.where(args)
+
+	query := fmt.Sprintf("SELECT %v FROM profiles WHERE org_id = $1%v%v ORDER BY created_at DESC, profile_id DESC LIMIT $2;", fields, position, conditions)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	profiles := []Profile{}
+	if err := stmt.SelectContext(ctx, &profiles, args...); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// CountProfiles returns a count of the profiles for the given org ID that match
+// filter from the database.
+func (r *SQLProfileRepository) CountProfiles(ctx context.Context, orgID string, filter ProfileFilter) (int, error) {
+	conditions, args := filter.where([]interface{}{orgID})
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM profiles WHERE org_id = $1%v;", conditions)
+
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return -1, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var count int
+	if err := stmt.GetContext(ctx, &count, args...); err != nil {
+		return -1, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return count, nil
+}
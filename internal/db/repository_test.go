@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestProfileRepositoryConcurrentUse(t *testing.T) {
+	db, err := Open("pgx", DSN)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close database: %v", err)
+		}
+	}()
+
+	if err := Migrate(db, true); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	if err := SeedData(db, []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at) VALUES ('84d3724c-1944-41d1-a12a-235eddca7771', '1', '2', '`+UNIXTime+`');`)); err != nil {
+		t.Fatalf("failed to seed database: %v", err)
+	}
+
+	profiles := NewProfileRepository(db)
+	defer profiles.Close()
+
+	// Each query is prepared by whichever goroutine uses it first.
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := profiles.GetCurrentProfile(context.Background(), "2")
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := profiles.CountProfiles(context.Background(), "2", ProfileFilter{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+	}
+}
+
+func TestGetOrInsertCurrentProfileConcurrent(t *testing.T) {
+	db, err := Open("pgx", DSN)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close database: %v", err)
+		}
+	}()
+
+	if err := Migrate(db, true); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	profiles := NewProfileRepository(db)
+	defer profiles.Close()
+
+	// Every call finds no current profile and races to insert its own.
+	var wg sync.WaitGroup
+	ids := make(chan uuid.UUID, 10)
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			profile, err := profiles.GetOrInsertCurrentProfile(context.Background(), "2", NewProfile("2", "1", map[string]string{"insights": "enabled"}))
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- profile.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("got error: %v", err)
+	}
+
+	current, err := profiles.GetCurrentProfile(context.Background(), "2")
+	if err != nil {
+		t.Fatalf("failed to get current profile: %v", err)
+	}
+	for id := range ids {
+		if id != current.ID {
+			t.Errorf("%v != %v", id, current.ID)
+		}
+	}
+
+	count, err := profiles.CountProfiles(context.Background(), "2", ProfileFilter{})
+	if err != nil {
+		t.Fatalf("failed to count profiles: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("%v != 1", count)
+	}
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TemplateRepository stores and retrieves the profile templates of orgs. Its
+// methods are safe for concurrent use.
+type TemplateRepository interface {
+	InsertTemplate(ctx context.Context, template Template) error
+	UpdateTemplate(ctx context.Context, template Template, updatedAt time.Time) (*Template, error)
+	DeleteTemplate(ctx context.Context, orgID string, name string) error
+	GetTemplate(ctx context.Context, orgID string, name string) (*Template, error)
+	GetDefaultTemplate(ctx context.Context, orgID string) (*Template, error)
+	GetTemplates(ctx context.Context, orgID string, limit int, offset int) ([]Template, error)
+	CountTemplates(ctx context.Context, orgID string) (int, error)
+}
+
+// Names of the unique constraints of the profile_templates table.
+const (
+	templateNameConstraint    = "profile_templates_pkey"
+	templateDefaultConstraint = "profile_templates_org_id_default_idx"
+)
+
+var (
+	// ErrTemplateExists is wrapped by the error returned by InsertTemplate
+	// when the org already has a template with the same name.
+	ErrTemplateExists = errors.New("template already exists")
+
+	// ErrDefaultTemplateChanged is wrapped by the error returned by
+	// InsertTemplate and UpdateTemplate when another default template of the
+	// org was set concurrently.
+	ErrDefaultTemplateChanged = errors.New("default template changed")
+
+	// ErrTemplateChanged is wrapped by the error returned by UpdateTemplate
+	// when the template was updated since the expected time.
+	ErrTemplateChanged = errors.New("template changed")
+)
+
+// templateConstraintError returns an error wrapping ErrTemplateExists or
+// ErrDefaultTemplateChanged if err violates the corresponding constraint, and
+// err otherwise.
+func templateConstraintError(err error) error {
+	switch {
+	case isUniqueViolationOf(err, templateNameConstraint):
+		return fmt.Errorf("%w: %v", ErrTemplateExists, err)
+	case isUniqueViolationOf(err, templateDefaultConstraint):
+		return fmt.Errorf("%w: %v", ErrDefaultTemplateChanged, err)
+	default:
+		return err
+	}
+}
+
+// SQLTemplateRepository is a TemplateRepository backed by a database.
+type SQLTemplateRepository struct {
+	db         *sqlx.DB
+	statements *statementCache
+}
+
+// NewTemplateRepository creates a SQLTemplateRepository that queries db.
+func NewTemplateRepository(db *sqlx.DB) *SQLTemplateRepository {
+	return &SQLTemplateRepository{
+		db:         db,
+		statements: newStatementCache(db),
+	}
+}
+
+// Close closes the prepared statements of the repository. It does not close
+// the database.
+func (r *SQLTemplateRepository) Close() error {
+	return r.statements.close()
+}
+
+// InsertTemplate creates a new record in the profile_templates table from
+// template. If template is the default, the org's previous default template
+// is unset. If the org already has a template with the same name, the
+// returned error wraps ErrTemplateExists; if another default template was set
+// concurrently, it wraps ErrDefaultTemplateChanged.
+func (r *SQLTemplateRepository) InsertTemplate(ctx context.Context, template Template) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if template.Default {
+		if _, err := tx.ExecContext(ctx, `UPDATE profile_templates SET is_default = FALSE, updated_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND is_default;`, template.OrgID); err != nil {
+			return fmt.Errorf("cannot execute UPDATE: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ($1, $2, $3, $4);`, template.OrgID, template.Name, template.State, template.Default); err != nil {
+		return fmt.Errorf("cannot execute INSERT: %w", templateConstraintError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTemplate replaces the state and default flag of the template with the
+// name and org ID of template and returns the updated template. If template is
+// the default, the org's previous default template is unset. If updatedAt is
+// not zero, the template is only updated if it was last updated at updatedAt;
+// otherwise the returned error wraps ErrTemplateChanged. If no such template
+// exists, the returned error wraps sql.ErrNoRows; if another default template
+// was set concurrently, it wraps ErrDefaultTemplateChanged.
+func (r *SQLTemplateRepository) UpdateTemplate(ctx context.Context, template Template, updatedAt time.Time) (*Template, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastUpdatedAt time.Time
+	if err := tx.GetContext(ctx, &lastUpdatedAt, `SELECT timezone('UTC', updated_at) FROM profile_templates WHERE org_id = $1 AND name = $2 FOR UPDATE;`, template.OrgID, template.Name); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+	if !updatedAt.IsZero() && !lastUpdatedAt.Equal(updatedAt) {
+		return nil, fmt.Errorf("cannot update template: %w", ErrTemplateChanged)
+	}
+
+	if template.Default {
+		if _, err := tx.ExecContext(ctx, `UPDATE profile_templates SET is_default = FALSE, updated_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND name <> $2 AND is_default;`, template.OrgID, template.Name); err != nil {
+			return nil, fmt.Errorf("cannot execute UPDATE: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE profile_templates SET state = $3, is_default = $4, updated_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND name = $2 RETURNING %v;", templateFields)
+
+	var updated Template
+	if err := tx.GetContext(ctx, &updated, query, template.OrgID, template.Name, template.State, template.Default); err != nil {
+		return nil, fmt.Errorf("cannot execute UPDATE: %w", templateConstraintError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	return &updated, nil
+}
+
+// DeleteTemplate deletes the template with the given name and org ID. If no
+// such template exists, the returned error wraps sql.ErrNoRows.
+func (r *SQLTemplateRepository) DeleteTemplate(ctx context.Context, orgID string, name string) error {
+	stmt, err := r.statements.prepare(ctx, `DELETE FROM profile_templates WHERE org_id = $1 AND name = $2;`)
+	if err != nil {
+		return fmt.Errorf("cannot prepare DELETE: %w", err)
+	}
+
+	res, err := stmt.ExecContext(ctx, orgID, name)
+	if err != nil {
+		return fmt.Errorf("cannot execute DELETE: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("cannot find template: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// GetTemplate retrieves the template with the given name and org ID from the
+// database.
+func (r *SQLTemplateRepository) GetTemplate(ctx context.Context, orgID string, name string) (*Template, error) {
+	query := fmt.Sprintf("SELECT %v FROM profile_templates WHERE org_id = $1 AND name = $2;", templateFields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var template Template
+	if err := stmt.GetContext(ctx, &template, orgID, name); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return &template, nil
+}
+
+// GetDefaultTemplate retrieves the default template of the given org ID from
+// the database. If the org has no default template, the returned error wraps
+// sql.ErrNoRows.
+func (r *SQLTemplateRepository) GetDefaultTemplate(ctx context.Context, orgID string) (*Template, error) {
+	query := fmt.Sprintf("SELECT %v FROM profile_templates WHERE org_id = $1 AND is_default;", templateFields)
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var template Template
+	if err := stmt.GetContext(ctx, &template, orgID); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return &template, nil
+}
+
+// GetTemplates retrieves the templates of the given org ID from the database,
+// sorted by name.
+func (r *SQLTemplateRepository) GetTemplates(ctx context.Context, orgID string, limit int, offset int) ([]Template, error) {
+	query := fmt.Sprintf("SELECT %v FROM profile_templates WHERE org_id = $1 ORDER BY name", templateFields)
+	args := []interface{}{orgID}
+
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if offset > 0 {
+		args = append(args, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	query += ";"
+
+	stmt, err := r.statements.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	templates := []Template{}
+	if err := stmt.SelectContext(ctx, &templates, args...); err != nil {
+		return nil, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return templates, nil
+}
+
+// CountTemplates returns a count of all templates of the given org ID.
+func (r *SQLTemplateRepository) CountTemplates(ctx context.Context, orgID string) (int, error) {
+	stmt, err := r.statements.prepare(ctx, "SELECT COUNT(*) FROM profile_templates WHERE org_id = $1;")
+	if err != nil {
+		return -1, fmt.Errorf("cannot prepare SELECT: %w", err)
+	}
+
+	var count int
+	if err := stmt.GetContext(ctx, &count, orgID); err != nil {
+		return -1, fmt.Errorf("cannot execute SELECT: %w", err)
+	}
+
+	return count, nil
+}
@@ -1,25 +1,112 @@
 package db
 
 import (
+	"config-manager/internal/catalog"
 	"database/sql"
+	sqldriver "database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Profile struct {
-	ID           uuid.UUID       `json:"id" db:"profile_id"`
-	AccountID    *JSONNullString `json:"account_id,omitempty" db:"account_id"`
-	OrgID        *JSONNullString `json:"org_id,omitempty" db:"org_id"`
-	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
-	Active       bool            `json:"active" db:"active"`
-	Insights     bool            `json:"insights" db:"insights"`
-	Remediations bool            `json:"remediations" db:"remediations"`
-	Compliance   bool            `json:"compliance" db:"compliance"`
+	ID        uuid.UUID       `json:"id" db:"profile_id"`
+	AccountID *JSONNullString `json:"account_id,omitempty" db:"account_id"`
+	OrgID     *JSONNullString `json:"org_id,omitempty" db:"org_id"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	Active    bool            `json:"active" db:"active"`
+	State     StateMap        `json:"state" db:"state"`
+
+	// RestoredFrom is the ID of the profile this profile was restored from.
+	RestoredFrom *uuid.UUID `json:"restored_from,omitempty" db:"restored_from"`
+
+	// Principal is the user or service account that made the change, Reason
+	// the reason given for it and Source the part of the service it was made
+	// through (one of the Source constants).
+	Principal *JSONNullString `json:"principal,omitempty" db:"principal"`
+	Reason    *JSONNullString `json:"reason,omitempty" db:"reason"`
+	Source    *JSONNullString `json:"source,omitempty" db:"source"`
+}
+
+// Sources of profile changes.
+const (
+	SourceAPI               = "api"
+	SourceInventoryConsumer = "inventory-consumer"
+	SourceRestore           = "restore"
+	SourceAdmin             = "admin"
+)
+
+// legacyProfile adds the boolean fields that described a profile before the
+// service catalog to the JSON representation of a Profile. They are still
+// accepted and returned by the API for compatibility.
+type legacyProfile struct {
+	profile
+	Insights     *bool `json:"insights"`
+	Remediations *bool `json:"remediations"`
+	Compliance   *bool `json:"compliance"`
+}
+
+// profile has the fields of Profile but not its methods, so it can be embedded
+// in legacyProfile.
+type profile Profile
+
+// MarshalJSON implements the json.Marshaler interface, adding the legacy
+// boolean fields derived from the profile's state.
+func (p Profile) MarshalJSON() ([]byte, error) {
+	state := p.StateConfig()
+	enabled := func(service string) *bool {
+		v := state[service] == "enabled"
+		return &v
+	}
+
+	return json.Marshal(legacyProfile{
+		profile:      profile(p),
+		Insights:     enabled("insights"),
+		Remediations: enabled("remediations"),
+		Compliance:   enabled("compliance_openscap"),
+	})
 }
 
-// NewProfile creates a new, default Profile.
+// UnmarshalJSON implements the json.Unmarshaler interface. Legacy boolean
+// fields are merged into the profile's state unless the state sets the same
+// service.
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var v legacyProfile
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Profile(v.profile)
+
+	for service, enabled := range map[string]*bool{
+		"insights":            v.Insights,
+		"remediations":        v.Remediations,
+		"compliance_openscap": v.Compliance,
+	} {
+		if enabled == nil {
+			continue
+		}
+		if _, ok := p.State[service]; ok {
+			continue
+		}
+		if p.State == nil {
+			p.State = make(StateMap)
+		}
+		if *enabled {
+			p.State[service] = "enabled"
+		} else {
+			p.State[service] = "disabled"
+		}
+	}
+
+	return nil
+}
+
+// NewProfile creates a new, default Profile. Services missing from state are
+// set to their default value.
 func NewProfile(orgID string, accountID string, state map[string]string) *Profile {
 	profile := Profile{
 		ID:        uuid.New(),
@@ -27,8 +114,8 @@ func NewProfile(orgID string, accountID string, state map[string]string) *Profil
 		OrgID:     &JSONNullString{NullString: sql.NullString{Valid: orgID != "", String: orgID}},
 		CreatedAt: time.Now(),
 		Active:    true,
+		State:     catalog.Complete(state),
 	}
-	profile.SetStateConfig(state)
 
 	return &profile
 }
@@ -37,60 +124,141 @@ func NewProfile(orgID string, accountID string, state map[string]string) *Profil
 // where appropriate.
 func CopyProfile(from Profile) Profile {
 	return Profile{
-		ID:           uuid.New(),
-		AccountID:    from.AccountID,
-		OrgID:        from.OrgID,
-		CreatedAt:    time.Now(),
-		Active:       from.Active,
-		Insights:     from.Insights,
-		Remediations: from.Remediations,
-		Compliance:   from.Compliance,
+		ID:        uuid.New(),
+		AccountID: from.AccountID,
+		OrgID:     from.OrgID,
+		CreatedAt: time.Now(),
+		Active:    from.Active,
+		State:     maps.Clone(from.State),
 	}
 }
 
+// SetChange records who made the change that created the profile, why and
+// through which source. Empty values are stored as null.
+func (p *Profile) SetChange(principal string, reason string, source string) {
+	p.Principal = nullString(principal)
+	p.Reason = nullString(reason)
+	p.Source = nullString(source)
+}
+
 func (p Profile) Equal(q Profile) bool {
-	return p.Active == q.Active && p.Insights == q.Insights && p.Compliance == q.Compliance && p.Remediations == q.Remediations
+	return p.Active == q.Active && maps.Equal(p.StateConfig(), q.StateConfig())
 }
 
-// StateConfig formats the profile's state values as a "state map".
-func (p Profile) StateConfig() map[string]string {
-	state := make(map[string]string)
+// ServiceChange describes a service whose value differs between two profiles.
+// From or To is empty if the service is only set in one of the profiles.
+type ServiceChange struct {
+	Service string `json:"service"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
 
-	if p.Insights {
-		state["insights"] = "enabled"
-	} else {
-		state["insights"] = "disabled"
-	}
+// Diff returns the services whose values differ between from and p, sorted by
+// service name. Services missing from a profile's state are compared using
+// their default value.
+func (p Profile) Diff(from Profile) []ServiceChange {
+	before := from.StateConfig()
+	after := p.StateConfig()
 
-	if p.Remediations {
-		state["remediations"] = "enabled"
-	} else {
-		state["remediations"] = "disabled"
+	services := slices.Collect(maps.Keys(before))
+	for service := range after {
+		if _, ok := before[service]; !ok {
+			services = append(services, service)
+		}
 	}
+	slices.Sort(services)
 
-	if p.Compliance {
-		state["compliance_openscap"] = "enabled"
-	} else {
-		state["compliance_openscap"] = "disabled"
+	changes := []ServiceChange{}
+	for _, service := range services {
+		if before[service] != after[service] {
+			changes = append(changes, ServiceChange{Service: service, From: before[service], To: after[service]})
+		}
 	}
 
-	return state
+	return changes
+}
+
+// Violations returns the service dependencies that the profile's state does
+// not satisfy.
+func (p Profile) Violations() []catalog.Violation {
+	return catalog.Check(p.State)
+}
+
+// StateConfig formats the profile's state values as a "state map". Services
+// missing from the profile's state are set to their default value.
+func (p Profile) StateConfig() map[string]string {
+	return catalog.Complete(p.State)
 }
 
 // SetStateConfig parses a "state map" and updates the profile's state values
 // accordingly.
 func (p *Profile) SetStateConfig(state map[string]string) {
-	if v, has := state["insights"]; has {
-		p.Insights = v == "enabled"
+	if p.State == nil {
+		p.State = make(StateMap, len(state))
 	}
+	maps.Copy(p.State, state)
+}
 
-	if v, has := state["remediations"]; has {
-		p.Remediations = v == "enabled"
+// StateMap is a "state map" stored as a JSONB value.
+type StateMap map[string]string
+
+// Value implements the driver.Valuer interface.
+func (m StateMap) Value() (sqldriver.Value, error) {
+	if m == nil {
+		return `{}`, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
 	}
+	return string(data), nil
+}
 
-	if v, has := state["compliance_openscap"]; has {
-		p.Compliance = v == "enabled"
+// Scan implements the sql.Scanner interface.
+func (m *StateMap) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StateMap", src)
 	}
+
+	return json.Unmarshal(data, m)
+}
+
+// Template is a named "state map" used to seed the first profile of an org.
+// At most one template per org is the default.
+type Template struct {
+	OrgID     string    `json:"org_id" db:"org_id"`
+	Name      string    `json:"name" db:"name"`
+	State     StateMap  `json:"state" db:"state"`
+	Default   bool      `json:"default" db:"is_default"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Statuses of a HostRun.
+const (
+	HostRunStatusPending  = "pending"
+	HostRunStatusSuccess  = "success"
+	HostRunStatusFailure  = "failure"
+	HostRunStatusTimeout  = "timeout"
+	HostRunStatusCanceled = "canceled"
+)
+
+// HostRun records an attempt to apply a profile to a host through
+// playbook-dispatcher. RunID is null if the run could not be created.
+type HostRun struct {
+	HostID    uuid.UUID     `json:"host_id" db:"host_id"`
+	OrgID     string        `json:"org_id" db:"org_id"`
+	ProfileID uuid.UUID     `json:"profile_id" db:"profile_id"`
+	RunID     uuid.NullUUID `json:"run_id" db:"run_id"`
+	Status    string        `json:"status" db:"status"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
 }
 
 // JSONNullBool represents a bool that may be null simultaneously in a SQL
@@ -135,6 +303,14 @@ type JSONNullString struct {
 	sql.NullString
 }
 
+// nullString returns a JSONNullString for s, or nil if s is empty.
+func nullString(s string) *JSONNullString {
+	if s == "" {
+		return nil
+	}
+	return &JSONNullString{NullString: sql.NullString{Valid: true, String: s}}
+}
+
 // JSONNullStringSafeValue returns the string value of n if it is a valid value,
 // otherwise it returns "".
 func JSONNullStringSafeValue(n *JSONNullString) string {
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"config-manager/internal/catalog"
 	"database/sql"
 	"encoding/json"
 	"testing"
@@ -20,16 +21,25 @@ func TestProfileMarshalJSON(t *testing.T) {
 	}{
 		{
 			input: Profile{
-				ID:           uuid.MustParse("a863569d-6e57-4082-ba80-20e0089738ff"),
-				AccountID:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "123456"}},
-				OrgID:        &JSONNullString{NullString: sql.NullString{Valid: true, String: "654321"}},
-				CreatedAt:    time.Unix(0, 0).UTC(),
-				Active:       true,
-				Insights:     true,
-				Remediations: true,
-				Compliance:   true,
+				ID:        uuid.MustParse("a863569d-6e57-4082-ba80-20e0089738ff"),
+				AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "123456"}},
+				OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "654321"}},
+				CreatedAt: time.Unix(0, 0).UTC(),
+				Active:    true,
+				State:     StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
 			},
-			want: []byte(`{"id":"a863569d-6e57-4082-ba80-20e0089738ff","account_id":"123456","org_id":"654321","created_at":"1970-01-01T00:00:00Z","active":true,"insights":true,"remediations":true,"compliance":true}`),
+			want: []byte(`{"id":"a863569d-6e57-4082-ba80-20e0089738ff","account_id":"123456","org_id":"654321","created_at":"1970-01-01T00:00:00Z","active":true,"state":{"compliance_openscap":"enabled","insights":"enabled","remediations":"enabled"},"insights":true,"remediations":true,"compliance":true}`),
+		},
+		{
+			description: "legacy fields default missing services",
+			input: Profile{
+				ID:        uuid.MustParse("a863569d-6e57-4082-ba80-20e0089738ff"),
+				AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "123456"}},
+				OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "654321"}},
+				CreatedAt: time.Unix(0, 0).UTC(),
+				State:     StateMap{"insights": "disabled"},
+			},
+			want: []byte(`{"id":"a863569d-6e57-4082-ba80-20e0089738ff","account_id":"123456","org_id":"654321","created_at":"1970-01-01T00:00:00Z","active":false,"state":{"insights":"disabled"},"insights":false,"remediations":true,"compliance":true}`),
 		},
 	}
 
@@ -63,16 +73,35 @@ func TestProfileUnmarshalJSON(t *testing.T) {
 		{
 			input: []byte(`{"id":"a863569d-6e57-4082-ba80-20e0089738ff","account_id":"123456","org_id":"654321","created_at":"1970-01-01T00:00:00Z","active":true,"insights":true,"remediations":true,"compliance":true}`),
 			want: Profile{
-				ID:           uuid.MustParse("a863569d-6e57-4082-ba80-20e0089738ff"),
-				AccountID:    &JSONNullString{NullString: sql.NullString{Valid: true, String: "123456"}},
-				OrgID:        &JSONNullString{NullString: sql.NullString{Valid: true, String: "654321"}},
-				CreatedAt:    time.Unix(0, 0).UTC(),
-				Active:       true,
-				Insights:     true,
-				Remediations: true,
-				Compliance:   true,
+				ID:        uuid.MustParse("a863569d-6e57-4082-ba80-20e0089738ff"),
+				AccountID: &JSONNullString{NullString: sql.NullString{Valid: true, String: "123456"}},
+				OrgID:     &JSONNullString{NullString: sql.NullString{Valid: true, String: "654321"}},
+				CreatedAt: time.Unix(0, 0).UTC(),
+				Active:    true,
+				State:     StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+			},
+		},
+		{
+			description: "state",
+			input:       []byte(`{"active":true,"state":{"insights":"enabled","compliance_openscap":"disabled"}}`),
+			want: Profile{
+				Active: true,
+				State:  StateMap{"insights": "enabled", "compliance_openscap": "disabled"},
 			},
 		},
+		{
+			description: "state takes precedence over legacy fields",
+			input:       []byte(`{"active":true,"state":{"insights":"enabled"},"insights":false,"remediations":false}`),
+			want: Profile{
+				Active: true,
+				State:  StateMap{"insights": "enabled", "remediations": "disabled"},
+			},
+		},
+		{
+			description: "invalid legacy field",
+			input:       []byte(`{"active":true,"insights":"yes"}`),
+			wantError:   cmpopts.AnyError,
+		},
 	}
 
 	for _, test := range tests {
@@ -96,6 +125,159 @@ func TestProfileUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestProfileEqual(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			p, q Profile
+		}
+		want bool
+	}{
+		{
+			description: "identical state",
+			input: struct {
+				p, q Profile
+			}{
+				p: Profile{ID: uuid.New(), Active: true, State: StateMap{"insights": "enabled"}},
+				q: Profile{ID: uuid.New(), Active: true, State: StateMap{"insights": "enabled"}},
+			},
+			want: true,
+		},
+		{
+			description: "missing service equals its default",
+			input: struct {
+				p, q Profile
+			}{
+				p: Profile{Active: true, State: StateMap{"insights": "enabled"}},
+				q: Profile{Active: true, State: StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}},
+			},
+			want: true,
+		},
+		{
+			description: "different state",
+			input: struct {
+				p, q Profile
+			}{
+				p: Profile{Active: true, State: StateMap{"insights": "enabled"}},
+				q: Profile{Active: true, State: StateMap{"insights": "disabled"}},
+			},
+			want: false,
+		},
+		{
+			description: "different active",
+			input: struct {
+				p, q Profile
+			}{
+				p: Profile{Active: true, State: StateMap{"insights": "enabled"}},
+				q: Profile{Active: false, State: StateMap{"insights": "enabled"}},
+			},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := test.input.p.Equal(test.input.q); got != test.want {
+				t.Errorf("%v != %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProfileViolations(t *testing.T) {
+	tests := []struct {
+		description string
+		input       Profile
+		want        []catalog.Violation
+	}{
+		{
+			description: "satisfied dependencies",
+			input:       Profile{Active: true, State: StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "disabled"}},
+			want:        nil,
+		},
+		{
+			description: "remediations without insights",
+			input:       Profile{Active: true, State: StateMap{"insights": "disabled", "remediations": "enabled", "compliance_openscap": "disabled"}},
+			want: []catalog.Violation{
+				{Service: "remediations", Value: "enabled", Requires: "insights", RequiredValue: "enabled", ActualValue: "disabled"},
+			},
+		},
+		{
+			description: "compliance without insights",
+			input:       Profile{Active: true, State: StateMap{"insights": "disabled", "remediations": "disabled", "compliance_openscap": "enabled"}},
+			want: []catalog.Violation{
+				{Service: "compliance_openscap", Value: "enabled", Requires: "insights", RequiredValue: "enabled", ActualValue: "disabled"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := test.input.Violations()
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestProfileDiff(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			p, from Profile
+		}
+		want []ServiceChange
+	}{
+		{
+			description: "identical state",
+			input: struct {
+				p, from Profile
+			}{
+				p:    Profile{State: StateMap{"insights": "enabled"}},
+				from: Profile{State: StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}},
+			},
+			want: []ServiceChange{},
+		},
+		{
+			description: "changed services",
+			input: struct {
+				p, from Profile
+			}{
+				p:    Profile{State: StateMap{"insights": "enabled", "remediations": "disabled", "compliance_openscap": "disabled"}},
+				from: Profile{State: StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}},
+			},
+			want: []ServiceChange{
+				{Service: "compliance_openscap", From: "enabled", To: "disabled"},
+				{Service: "remediations", From: "enabled", To: "disabled"},
+			},
+		},
+		{
+			description: "service missing from catalog",
+			input: struct {
+				p, from Profile
+			}{
+				p:    Profile{State: StateMap{"insights": "enabled"}},
+				from: Profile{State: StateMap{"insights": "enabled", "malware": "enabled"}},
+			},
+			want: []ServiceChange{
+				{Service: "malware", From: "enabled"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := test.input.p.Diff(test.input.from)
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
 func TestJSONNullBoolMarshalJSON(t *testing.T) {
 	tests := []struct {
 		description string
@@ -366,3 +548,48 @@ func TestJSONNullStringUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestStateMapScan(t *testing.T) {
+	tests := []struct {
+		description string
+		input       any
+		want        StateMap
+		wantError   bool
+	}{
+		{
+			description: "bytes",
+			input:       []byte(`{"insights":"enabled"}`),
+			want:        StateMap{"insights": "enabled"},
+		},
+		{
+			description: "string",
+			input:       `{"insights":"disabled"}`,
+			want:        StateMap{"insights": "disabled"},
+		},
+		{
+			description: "unsupported type",
+			input:       42,
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got StateMap
+			err := got.Scan(test.input)
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
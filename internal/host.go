@@ -1,16 +1,73 @@
 package internal
 
+import "time"
+
 // Host represents a system record from the Inventory application.
 type Host struct {
-	ID                    string                 `json:"id"`
-	Account               string                 `json:"account"`
-	OrgID                 string                 `json:"org_id"`
-	DisplayName           string                 `json:"display_name"`
-	Reporter              string                 `json:"reporter"`
-	PerReporterStaleness  map[string]interface{} `json:"per_reporter_staleness"`
-	SubscriptionManagerID string                 `json:"subscription_manager_id"`
-	SystemProfile         struct {
-		RHCID    string `json:"rhc_client_id"`
-		RHCState string `json:"rhc_config_state"`
-	} `json:"system_profile"`
+	ID                    string                       `json:"id"`
+	Account               string                       `json:"account"`
+	OrgID                 string                       `json:"org_id"`
+	DisplayName           string                       `json:"display_name"`
+	AnsibleHost           string                       `json:"ansible_host"`
+	FQDN                  string                       `json:"fqdn"`
+	InsightsID            string                       `json:"insights_id"`
+	SatelliteID           string                       `json:"satellite_id"`
+	BIOSUUID              string                       `json:"bios_uuid"`
+	IPAddresses           []string                     `json:"ip_addresses"`
+	MACAddresses          []string                     `json:"mac_addresses"`
+	ProviderID            string                       `json:"provider_id"`
+	ProviderType          string                       `json:"provider_type"`
+	Reporter              string                       `json:"reporter"`
+	PerReporterStaleness  map[string]ReporterStaleness `json:"per_reporter_staleness"`
+	SubscriptionManagerID string                       `json:"subscription_manager_id"`
+	Tags                  []Tag                        `json:"tags"`
+	Groups                []Group                      `json:"groups"`
+	SystemProfile         SystemProfile                `json:"system_profile"`
+	Created               *time.Time                   `json:"created,omitempty"`
+	Updated               *time.Time                   `json:"updated,omitempty"`
+	StaleTimestamp        *time.Time                   `json:"stale_timestamp,omitempty"`
+	StaleWarningTimestamp *time.Time                   `json:"stale_warning_timestamp,omitempty"`
+	CulledTimestamp       *time.Time                   `json:"culled_timestamp,omitempty"`
+}
+
+// SystemProfile represents the subset of a host's system profile used by
+// config-manager.
+type SystemProfile struct {
+	RHCID                 string           `json:"rhc_client_id"`
+	RHCState              string           `json:"rhc_config_state"`
+	OwnerID               string           `json:"owner_id,omitempty"`
+	HostType              string           `json:"host_type,omitempty"`
+	Arch                  string           `json:"arch,omitempty"`
+	OSRelease             string           `json:"os_release,omitempty"`
+	OperatingSystem       *OperatingSystem `json:"operating_system,omitempty"`
+	InsightsClientVersion string           `json:"insights_client_version,omitempty"`
+}
+
+// OperatingSystem identifies the operating system installed on a host.
+type OperatingSystem struct {
+	Name  string `json:"name"`
+	Major int    `json:"major"`
+	Minor int    `json:"minor"`
+}
+
+// ReporterStaleness records when a reporter last reported a host.
+type ReporterStaleness struct {
+	LastCheckIn           *time.Time `json:"last_check_in,omitempty"`
+	StaleTimestamp        *time.Time `json:"stale_timestamp,omitempty"`
+	StaleWarningTimestamp *time.Time `json:"stale_warning_timestamp,omitempty"`
+	CulledTimestamp       *time.Time `json:"culled_timestamp,omitempty"`
+	CheckInSucceeded      bool       `json:"check_in_succeeded"`
+}
+
+// Tag is a namespaced key/value pair attached to a host.
+type Tag struct {
+	Namespace *string `json:"namespace"`
+	Key       string  `json:"key"`
+	Value     *string `json:"value"`
+}
+
+// Group is an inventory group a host belongs to.
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
@@ -0,0 +1,105 @@
+package v2
+
+import (
+	"config-manager/internal/db"
+	"config-manager/internal/http/render"
+	"config-manager/internal/instrumentation"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+	"github.com/rs/zerolog/log"
+)
+
+// ProfileDiff is the response body returned by getProfileDiff.
+type ProfileDiff struct {
+	ID      uuid.UUID          `json:"id"`
+	Against uuid.UUID          `json:"against"`
+	Active  *ActiveChange      `json:"active,omitempty"`
+	Changes []db.ServiceChange `json:"changes"`
+}
+
+// ActiveChange describes a change of a profile's active field.
+type ActiveChange struct {
+	From bool `json:"from"`
+	To   bool `json:"to"`
+}
+
+// getProfileDiff returns the changes between the profile identified by the
+// "against" query parameter and the profile identified by the "id" path
+// parameter, which may be the special value "current". If "against" is not
+// set, the profile is compared against the profile that preceded it.
+func (s *server) getProfileDiff(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	profileID := chi.URLParam(r, "id")
+
+	var profile *db.Profile
+	var err error
+	if profileID == "current" {
+		profile, err = s.profiles.GetCurrentProfile(r.Context(), id.Identity.OrgID)
+	} else {
+		if _, err := uuid.Parse(profileID); err != nil {
+			render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse profile ID: %v", err), logger)
+			return
+		}
+		profile, err = s.profiles.GetProfile(r.Context(), id.Identity.OrgID, profileID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find profile with ID: %v", profileID), logger)
+			return
+		}
+		instrumentation.GetProfileDiffError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profile: %v", err), logger)
+		return
+	}
+
+	var against *db.Profile
+	if againstID := r.URL.Query().Get("against"); againstID != "" {
+		if _, err := uuid.Parse(againstID); err != nil {
+			render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse against: %v", err), logger)
+			return
+		}
+		against, err = s.profiles.GetProfile(r.Context(), id.Identity.OrgID, againstID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find profile with ID: %v", againstID), logger)
+				return
+			}
+			instrumentation.GetProfileDiffError()
+			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profile: %v", err), logger)
+			return
+		}
+	} else {
+		against, err = s.profiles.GetPreviousProfile(r.Context(), id.Identity.OrgID, profile.ID.String())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find previous profile of profile with ID: %v", profile.ID), logger)
+				return
+			}
+			instrumentation.GetProfileDiffError()
+			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get previous profile: %v", err), logger)
+			return
+		}
+	}
+
+	response := ProfileDiff{
+		ID:      profile.ID,
+		Against: against.ID,
+		Changes: profile.Diff(*against),
+	}
+	if profile.Active != against.Active {
+		response.Active = &ActiveChange{From: against.Active, To: profile.Active}
+	}
+
+	render.RenderJSON(w, r, http.StatusOK, response, logger)
+}
@@ -0,0 +1,125 @@
+package v2
+
+import (
+	"bytes"
+	"config-manager/internal/db"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+)
+
+func TestGetProfileDiff(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "diff against previous profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', FALSE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', NOW(), TRUE, '{"insights":"enabled","remediations":"disabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/current/diff",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"id":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf","against":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","active":{"from":false,"to":true},"changes":[{"service":"remediations","from":"enabled","to":"disabled"}]}`),
+			},
+		},
+		{
+			description: "diff against given profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', NOW(), TRUE, '{"insights":"enabled","remediations":"disabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/diff?against=3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","against":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf","changes":[{"service":"remediations","from":"disabled","to":"enabled"}]}`),
+			},
+		},
+		{
+			description: "diff of first profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/diff",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find previous profile of profile with ID: b5db9cbc-4ecd-464b-b416-3a6cd67af87a`),
+			},
+		},
+		{
+			description: "diff against profile belonging to another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', NOW(), TRUE, '{"insights":"disabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/diff?against=3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find profile with ID: 3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf`),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/profiles/{id}/diff", s.getProfileDiff)
+			router.ServeHTTP(rr, req)
+
+			got := response{rr.Code, bytes.TrimSpace(rr.Body.Bytes())}
+
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{})) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
+			}
+		})
+	}
+}
@@ -1,24 +1,285 @@
 package v2
 
 import (
-	"config-manager/internal/config"
+	"bytes"
+	"config-manager/internal/catalog"
 	"config-manager/internal/db"
 	"config-manager/internal/http/render"
 	"config-manager/internal/instrumentation"
+	"config-manager/internal/patch"
+	"config-manager/internal/reconcile"
+	"config-manager/internal/templates"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// ProfileApplier applies a profile to the hosts of the org identified in the
+// context.
+type ProfileApplier interface {
+	ApplyProfile(ctx context.Context, profile db.Profile, principal string) ([]reconcile.Run, error)
+}
+
+// server holds the dependencies of the v2 API handlers, which are its
+// methods. It is created by NewMux.
+type server struct {
+	profiles  db.ProfileRepository
+	hostRuns  db.HostRunRepository
+	templates db.TemplateRepository
+
+	// applier is used by saveProfile to apply new profiles to connected
+	// hosts.
+	applier ProfileApplier
+
+	// applies tracks the profiles being applied after their response was
+	// sent.
+	applies sync.WaitGroup
+}
+
+// ProfileList is the paginated response body returned by getProfiles.
+type ProfileList struct {
+	Meta  Meta         `json:"meta"`
+	Links Links        `json:"links"`
+	Data  []db.Profile `json:"data"`
+}
+
+// getProfiles returns a paginated list of the profiles belonging to the org of
+// the identity defined by the X-Rh-Identity header, filtered and sorted by the
+// query parameters. If the "cursor" query parameter is present, the list is
+// paginated by cursor instead of offset.
+func (s *server) getProfiles(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+		return
+	}
+
+	filter, err := db.ParseProfileFilter(r.URL.Query())
+	if err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+		return
+	}
+
+	if r.URL.Query().Has("cursor") {
+		s.getProfilesAfter(w, r, filter, limit, logger)
+		return
+	}
+
+	sort, err := db.ParseSort(r.URL.Query().Get("sort_by"))
+	if err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+		return
+	}
+	if len(sort) == 0 {
+		sort = []db.SortKey{{Field: "created_at", Descending: true}}
+	}
+
+	profiles, err := s.profiles.GetProfiles(r.Context(), id.Identity.OrgID, filter, sort, limit, offset)
+	if err != nil {
+		instrumentation.GetProfilesError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profiles: %v", err), logger)
+		return
+	}
+
+	count, err := s.profiles.CountProfiles(r.Context(), id.Identity.OrgID, filter)
+	if err != nil {
+		instrumentation.GetProfilesError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot count profiles: %v", err), logger)
+		return
+	}
+
+	response := ProfileList{
+		Meta: Meta{
+			Count:  count,
+			Limit:  limit,
+			Offset: offset,
+		},
+		Links: newLinks(r.URL, limit, offset, count),
+		Data:  profiles,
+	}
+
+	render.RenderJSON(w, r, http.StatusOK, response, logger)
+}
+
+// getProfilesAfter responds with a page of at most limit profiles of the org of
+// the identity defined by the X-Rh-Identity header that match filter, newest
+// first, starting after the position given by the "cursor" query parameter. An
+// empty cursor starts from the newest profile.
+func (s *server) getProfilesAfter(w http.ResponseWriter, r *http.Request, filter db.ProfileFilter, limit int, logger zerolog.Logger) {
+	id := identity.GetIdentity(r.Context())
+
+	query := r.URL.Query()
+	if query.Has("offset") || query.Has("sort_by") {
+		render.RenderPlain(w, r, http.StatusBadRequest, "cursor cannot be combined with offset or sort_by", logger)
+		return
+	}
+
+	var after *db.Cursor
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := db.ParseCursor(v)
+		if err != nil {
+			render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+			return
+		}
+		after = &cursor
+	}
+
+	// One more profile than requested tells whether there is a next page.
+	profiles, err := s.profiles.GetProfilesAfter(r.Context(), id.Identity.OrgID, filter, after, limit+1)
+	if err != nil {
+		instrumentation.GetProfilesError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profiles: %v", err), logger)
+		return
+	}
+
+	var next string
+	if len(profiles) > limit {
+		profiles = profiles[:limit]
+		next = db.CursorOf(profiles[limit-1]).String()
+	}
+
+	count, err := s.profiles.CountProfiles(r.Context(), id.Identity.OrgID, filter)
+	if err != nil {
+		instrumentation.GetProfilesError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot count profiles: %v", err), logger)
+		return
+	}
+
+	response := ProfileList{
+		Meta: Meta{
+			Count: count,
+			Limit: limit,
+		},
+		Links: newCursorLinks(r.URL, limit, next),
+		Data:  profiles,
+	}
+
+	render.RenderJSON(w, r, http.StatusOK, response, logger)
+}
+
+// HostRunList is the paginated response body returned by getProfileHosts.
+type HostRunList struct {
+	Meta  Meta         `json:"meta"`
+	Links Links        `json:"links"`
+	Data  []db.HostRun `json:"data"`
+}
+
+// getHostStatus returns the most recent attempt to apply a profile to the host
+// identified by the "id" path parameter, restricted to the hosts of the org of
+// the identity defined by the X-Rh-Identity header.
+func (s *server) getHostStatus(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	hostID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(hostID); err != nil {
+		instrumentation.GetHostStatusError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse host ID: %v", err), logger)
+		return
+	}
+
+	run, err := s.hostRuns.GetCurrentHostRun(r.Context(), id.Identity.OrgID, hostID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find status for host with ID: %v", hostID), logger)
+			return
+		}
+		instrumentation.GetHostStatusError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get status for host: %v", err), logger)
+		return
+	}
+
+	render.RenderJSON(w, r, http.StatusOK, run, logger)
+}
+
+// getProfileHosts returns a paginated list of the attempts to apply the profile
+// identified by the "id" path parameter to the hosts of the org of the identity
+// defined by the X-Rh-Identity header.
+func (s *server) getProfileHosts(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	profileID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(profileID); err != nil {
+		instrumentation.GetProfileHostsError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse profile ID: %v", err), logger)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		instrumentation.GetProfileHostsError()
+		render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+		return
+	}
+
+	if _, err := s.profiles.GetProfile(r.Context(), id.Identity.OrgID, profileID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find profile with ID: %v", profileID), logger)
+			return
+		}
+		instrumentation.GetProfileHostsError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profile with ID: %v", err), logger)
+		return
+	}
+
+	runs, err := s.hostRuns.GetHostRunsForProfile(r.Context(), id.Identity.OrgID, profileID, limit, offset)
+	if err != nil {
+		instrumentation.GetProfileHostsError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get hosts for profile: %v", err), logger)
+		return
+	}
+
+	count, err := s.hostRuns.CountHostRunsForProfile(r.Context(), id.Identity.OrgID, profileID)
+	if err != nil {
+		instrumentation.GetProfileHostsError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot count hosts for profile: %v", err), logger)
+		return
+	}
+
+	response := HostRunList{
+		Meta: Meta{
+			Count:  count,
+			Limit:  limit,
+			Offset: offset,
+		},
+		Links: newLinks(r.URL, limit, offset, count),
+		Data:  runs,
+	}
+
+	render.RenderJSON(w, r, http.StatusOK, response, logger)
+}
+
 // getProfile returns a single profile identified by the "id" path parameter,
 // restricted to the profiles available to the identity defined by the
-// X-Rh-Identity header.
-func getProfile(w http.ResponseWriter, r *http.Request) {
+// X-Rh-Identity header. Profiles belonging to another org are reported as not
+// found.
+func (s *server) getProfile(w http.ResponseWriter, r *http.Request) {
 	logger := log.With().Logger()
 	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
 
@@ -35,33 +296,74 @@ func getProfile(w http.ResponseWriter, r *http.Request) {
 	var profile *db.Profile
 	if profileID == "current" {
 		var err error
-		var statemap map[string]string
-		if err := json.Unmarshal([]byte(config.DefaultConfig.ServiceConfig), &statemap); err != nil {
-			instrumentation.GetProfileError()
-			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot unmarshal statemap: %v", err), logger)
-			return
-		}
-		profile, err = db.GetOrInsertCurrentProfile(id.Identity.OrgID, db.NewProfile(id.Identity.OrgID, id.Identity.AccountNumber, statemap))
+		profile, err = templates.CurrentProfile(r.Context(), s.profiles, s.templates, id.Identity.OrgID, id.Identity.AccountNumber, principal(id), db.SourceAPI)
 		if err != nil {
 			instrumentation.GetProfileError()
 			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get current profile for org: %v", err), logger)
 			return
 		}
 	} else {
+		if _, err := uuid.Parse(profileID); err != nil {
+			instrumentation.GetProfileError()
+			render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse profile ID: %v", err), logger)
+			return
+		}
+
 		var err error
-		profile, err = db.GetProfile(profileID)
+		profile, err = s.profiles.GetProfile(r.Context(), id.Identity.OrgID, profileID)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find profile with ID: %v", profileID), logger)
+				return
+			}
 			instrumentation.GetProfileError()
 			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profile with ID: %v", err), logger)
 			return
 		}
 	}
 
+	w.Header().Set("ETag", etag(*profile))
 	render.RenderJSON(w, r, http.StatusOK, profile, logger)
 }
 
+// etag returns the entity tag of profile. Profiles are never modified, so the
+// tag is derived from the profile ID alone.
+func etag(profile db.Profile) string {
+	return fmt.Sprintf("%q", profile.ID.String())
+}
+
+// ifMatch reports whether the If-Match header of r, if any, matches the entity
+// tag want. Weak tags never match, as required by RFC 9110.
+func ifMatch(r *http.Request, want string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPrecondition responds with 412 Precondition Failed and returns false if
+// the If-Match header of r does not match currentProfile.
+func checkPrecondition(w http.ResponseWriter, r *http.Request, currentProfile db.Profile, logger zerolog.Logger) bool {
+	if ifMatch(r, etag(currentProfile)) {
+		return true
+	}
+
+	w.Header().Set("ETag", etag(currentProfile))
+	render.RenderPlain(w, r, http.StatusPreconditionFailed, fmt.Sprintf("current profile does not match If-Match: %v", r.Header.Get("If-Match")), logger)
+	return false
+}
+
 // createProfile creates and inserts a profile.
-func createProfile(w http.ResponseWriter, r *http.Request) {
+func (s *server) createProfile(w http.ResponseWriter, r *http.Request) {
 	logger := log.With().Logger()
 	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
 
@@ -83,29 +385,305 @@ func createProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentProfile, err := db.GetCurrentProfile(id.Identity.OrgID)
+	if err := catalog.Validate(requestedProfile.State); err != nil {
+		instrumentation.CreateProfileError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("invalid state: %v", err), logger)
+		return
+	}
+
+	currentProfile, err := templates.CurrentProfile(r.Context(), s.profiles, s.templates, id.Identity.OrgID, id.Identity.AccountNumber, principal(id), db.SourceAPI)
 	if err != nil {
 		instrumentation.CreateProfileError()
 		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get current profile: %v", err), logger)
 		return
 	}
 
-	newProfile := db.CopyProfile(*currentProfile)
-	newProfile.Active = requestedProfile.Active
-	newProfile.Insights = requestedProfile.Insights
-	newProfile.Remediations = requestedProfile.Remediations
-	newProfile.Compliance = requestedProfile.Compliance
+	if !checkPrecondition(w, r, *currentProfile, logger) {
+		return
+	}
+
+	// The requested profile replaces the current one; services left out of
+	// the request take their default value.
+	build := func(current db.Profile) (db.Profile, error) {
+		newProfile := db.CopyProfile(current)
+		newProfile.Active = requestedProfile.Active
+		newProfile.State = catalog.Complete(requestedProfile.State)
+		newProfile.SetChange(principal(id), db.JSONNullStringSafeValue(requestedProfile.Reason), db.SourceAPI)
+		return newProfile, nil
+	}
+
+	s.saveProfile(w, r, currentProfile, build, http.StatusCreated, instrumentation.CreateProfileError, logger)
+}
 
-	if newProfile.Equal(*currentProfile) {
-		render.RenderJSON(w, r, http.StatusNotModified, currentProfile, logger)
+// profileDocument is the representation of the current profile that PATCH
+// requests are applied to.
+type profileDocument struct {
+	Active *bool             `json:"active"`
+	State  map[string]string `json:"state"`
+	Reason string            `json:"reason,omitempty"`
+}
+
+// patchProfile applies a JSON Merge Patch or JSON Patch document, as given by
+// the Content-Type header, to the current profile and inserts the result as a
+// new profile. Services removed from the state are reset to their default
+// value. A reason for the change may be added to the document by the patch.
+func (s *server) patchProfile(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	var applyPatch func(doc []byte, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case patch.MediaTypeMergePatch:
+		applyPatch = patch.MergePatch
+	case patch.MediaTypeJSONPatch:
+		applyPatch = patch.JSONPatch
+	default:
+		render.RenderPlain(w, r, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported media type: %v", mediaType), logger)
 		return
 	}
 
-	if err := db.InsertProfile(newProfile); err != nil {
-		instrumentation.CreateProfileError()
-		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot insert new profile: %v", err), logger)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		instrumentation.PatchProfileError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot read request body: %v", err), logger)
 		return
 	}
+	defer r.Body.Close()
 
-	render.RenderJSON(w, r, http.StatusCreated, newProfile, logger)
+	currentProfile, err := templates.CurrentProfile(r.Context(), s.profiles, s.templates, id.Identity.OrgID, id.Identity.AccountNumber, principal(id), db.SourceAPI)
+	if err != nil {
+		instrumentation.PatchProfileError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get current profile: %v", err), logger)
+		return
+	}
+
+	if !checkPrecondition(w, r, *currentProfile, logger) {
+		return
+	}
+
+	build := func(current db.Profile) (db.Profile, error) {
+		doc, err := json.Marshal(profileDocument{
+			Active: &current.Active,
+			State:  current.StateConfig(),
+		})
+		if err != nil {
+			return db.Profile{}, fmt.Errorf("cannot marshal current profile: %w", err)
+		}
+
+		patched, err := applyPatch(doc, data)
+		if err != nil {
+			return db.Profile{}, fmt.Errorf("cannot apply patch: %w", err)
+		}
+
+		var requested profileDocument
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&requested); err != nil {
+			return db.Profile{}, fmt.Errorf("invalid patched profile: %w", err)
+		}
+		if requested.Active == nil {
+			return db.Profile{}, errors.New("invalid patched profile: missing active")
+		}
+
+		if err := catalog.Validate(requested.State); err != nil {
+			return db.Profile{}, fmt.Errorf("invalid state: %w", err)
+		}
+
+		newProfile := db.CopyProfile(current)
+		newProfile.Active = *requested.Active
+		newProfile.State = catalog.Complete(requested.State)
+		newProfile.SetChange(principal(id), requested.Reason, db.SourceAPI)
+		return newProfile, nil
+	}
+
+	s.saveProfile(w, r, currentProfile, build, http.StatusOK, instrumentation.PatchProfileError, logger)
+}
+
+// restoreProfile creates a new profile with the values of the profile
+// identified by the "id" path parameter, recording the profile it was restored
+// from and who restored it, and applies it to the org's connected hosts.
+func (s *server) restoreProfile(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	profileID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(profileID); err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse profile ID: %v", err), logger)
+		return
+	}
+
+	profile, err := s.profiles.GetProfile(r.Context(), id.Identity.OrgID, profileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find profile with ID: %v", profileID), logger)
+			return
+		}
+		instrumentation.RestoreProfileError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profile with ID: %v", err), logger)
+		return
+	}
+
+	currentProfile, err := templates.CurrentProfile(r.Context(), s.profiles, s.templates, id.Identity.OrgID, id.Identity.AccountNumber, principal(id), db.SourceAPI)
+	if err != nil {
+		instrumentation.RestoreProfileError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get current profile: %v", err), logger)
+		return
+	}
+
+	if !checkPrecondition(w, r, *currentProfile, logger) {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot unmarshal data: %v", err), logger)
+		return
+	}
+	defer r.Body.Close()
+
+	build := func(current db.Profile) (db.Profile, error) {
+		newProfile := db.CopyProfile(*profile)
+		newProfile.RestoredFrom = &profile.ID
+		newProfile.SetChange(principal(id), request.Reason, db.SourceRestore)
+		return newProfile, nil
+	}
+
+	s.saveProfile(w, r, currentProfile, build, http.StatusCreated, instrumentation.RestoreProfileError, logger)
+}
+
+// maxSaveAttempts is the number of times saveProfile tries to insert a new
+// profile while other profiles become current concurrently.
+const maxSaveAttempts = 5
+
+// saveProfile inserts the profile returned by build for currentProfile and
+// applies it to the org's connected hosts, responding with code. If build
+// fails, the request is rejected with 400 Bad Request. If the new profile
+// violates the dependencies between services it is rejected, and if it does
+// not differ from the current profile it is not inserted. If another profile
+// has become current in the meantime, the request is rejected with 412
+// Precondition Failed when it has an If-Match header; otherwise the new profile
+// is built again for the latest current profile, up to maxSaveAttempts times
+// before the request is rejected with 409 Conflict. countError is called on
+// server errors.
+func (s *server) saveProfile(w http.ResponseWriter, r *http.Request, currentProfile *db.Profile, build func(current db.Profile) (db.Profile, error), code int, countError func(), logger zerolog.Logger) {
+	var newProfile db.Profile
+	for attempt := 1; ; attempt++ {
+		var err error
+		newProfile, err = build(*currentProfile)
+		if err != nil {
+			if attempt > 1 {
+				render.RenderPlain(w, r, http.StatusConflict, fmt.Sprintf("cannot apply request to the current profile: %v", err), logger)
+				return
+			}
+			render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+			return
+		}
+
+		if violations := newProfile.Violations(); len(violations) > 0 {
+			renderViolations(w, r, violations, logger)
+			return
+		}
+
+		if newProfile.Equal(*currentProfile) {
+			w.Header().Set("ETag", etag(*currentProfile))
+			render.RenderJSON(w, r, http.StatusNotModified, currentProfile, logger)
+			return
+		}
+
+		err = s.profiles.InsertCurrentProfile(r.Context(), newProfile, currentProfile.ID)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, db.ErrProfileChanged) {
+			countError()
+			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot insert new profile: %v", err), logger)
+			return
+		}
+		if r.Header.Get("If-Match") != "" {
+			render.RenderPlain(w, r, http.StatusPreconditionFailed, fmt.Sprintf("cannot insert new profile: %v", err), logger)
+			return
+		}
+		if attempt == maxSaveAttempts {
+			render.RenderPlain(w, r, http.StatusConflict, fmt.Sprintf("cannot insert new profile after %v attempts: %v", attempt, err), logger)
+			return
+		}
+
+		// Without If-Match the change applies to whichever profile is
+		// current, so the request is applied again to the latest one.
+		currentProfile, err = s.profiles.GetCurrentProfile(r.Context(), db.JSONNullStringSafeValue(currentProfile.OrgID))
+		if err != nil {
+			countError()
+			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get current profile: %v", err), logger)
+			return
+		}
+		logger.Debug().Str("previous_id", currentProfile.ID.String()).Msg("current profile changed, building new profile again")
+	}
+
+	// Applying the profile may require many requests to inventory and
+	// playbook-dispatcher, so it continues after the response is sent.
+	s.applies.Add(1)
+	go func() {
+		defer s.applies.Done()
+		s.applyProfile(context.WithoutCancel(r.Context()), newProfile, principal(identity.GetIdentity(r.Context())), logger)
+	}()
+
+	w.Header().Set("ETag", etag(newProfile))
+	render.RenderJSON(w, r, code, newProfile, logger)
+}
+
+// DependencyError is the response body returned when a requested state does
+// not satisfy the dependencies between services.
+type DependencyError struct {
+	Message    string              `json:"message"`
+	Violations []catalog.Violation `json:"violations"`
+}
+
+// renderViolations writes a 422 response describing each violated dependency.
+func renderViolations(w http.ResponseWriter, r *http.Request, violations []catalog.Violation, logger zerolog.Logger) {
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.String())
+	}
+
+	response := DependencyError{
+		Message:    fmt.Sprintf("unsatisfied service dependencies: %v", strings.Join(messages, "; ")),
+		Violations: violations,
+	}
+
+	render.RenderJSON(w, r, http.StatusUnprocessableEntity, response, logger)
+}
+
+// applyProfile applies profile to the org's connected hosts, logging the
+// outcome.
+func (s *server) applyProfile(ctx context.Context, profile db.Profile, principal string, logger zerolog.Logger) {
+	logger = logger.With().Str("profile_id", profile.ID.String()).Logger()
+
+	runs, err := s.applier.ApplyProfile(ctx, profile, principal)
+	if err != nil {
+		logger.Error().Err(err).Int("runs", len(runs)).Msg("cannot apply profile to hosts")
+		return
+	}
+	logger.Info().Int("runs", len(runs)).Msg("applied profile to hosts")
+}
+
+// principal returns the name of the user or service account of the given
+// identity.
+func principal(id identity.XRHID) string {
+	switch {
+	case id.Identity.User != nil:
+		return id.Identity.User.Username
+	case id.Identity.ServiceAccount != nil:
+		return id.Identity.ServiceAccount.Username
+	default:
+		return ""
+	}
 }
@@ -3,6 +3,9 @@ package v2
 import (
 	"bytes"
 	"config-manager/internal/db"
+	"config-manager/internal/patch"
+	"config-manager/internal/reconcile"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,10 +17,14 @@ import (
 	"testing"
 	"time"
 
+	oapimiddleware "github.com/deepmap/oapi-codegen/pkg/chi-middleware"
 	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
 )
 
@@ -32,6 +39,56 @@ type response struct {
 	body []byte
 }
 
+// fakeApplier records the profiles passed to ApplyProfile.
+type fakeApplier struct {
+	applied chan db.Profile
+}
+
+func (f *fakeApplier) ApplyProfile(ctx context.Context, profile db.Profile, principal string) ([]reconcile.Run, error) {
+	f.applied <- profile
+	return nil, nil
+}
+
+// fakeRepository serves a current profile and fails successive inserts with
+// the errors of insertErrs, then succeeds. Each failed insert makes the next
+// profile of changes current. Its other methods are not implemented.
+type fakeRepository struct {
+	db.ProfileRepository
+	current    db.Profile
+	changes    []db.Profile
+	insertErrs []error
+	inserts    int
+	inserted   db.Profile
+}
+
+func (f *fakeRepository) GetCurrentProfile(ctx context.Context, orgID string) (*db.Profile, error) {
+	return &f.current, nil
+}
+
+func (f *fakeRepository) InsertCurrentProfile(ctx context.Context, profile db.Profile, previousID uuid.UUID) error {
+	f.inserts++
+	if len(f.insertErrs) == 0 {
+		f.inserted = profile
+		return nil
+	}
+	err := f.insertErrs[0]
+	f.insertErrs = f.insertErrs[1:]
+	if len(f.changes) > 0 {
+		f.current = f.changes[0]
+		f.changes = f.changes[1:]
+	}
+	return err
+}
+
+// newTestServer creates a server backed by database.
+func newTestServer(database *sqlx.DB) *server {
+	return &server{
+		profiles:  db.NewProfileRepository(database),
+		hostRuns:  db.NewHostRunRepository(database),
+		templates: db.NewTemplateRepository(database),
+	}
+}
+
 const (
 	UNIXTime string = "1970-01-01T00:00:00Z00"
 )
@@ -75,10 +132,11 @@ func TestGetProfile(t *testing.T) {
 		seed        []byte
 		input       request
 		want        response
+		wantETag    string
 	}{
 		{
 			description: "get profile by ID",
-			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, insights, remediations, compliance) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', FALSE, FALSE, FALSE), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '` + UNIXTime + `', TRUE, TRUE, TRUE);`),
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
 			input: request{
 				method: http.MethodGet,
 				url:    "/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
@@ -88,12 +146,13 @@ func TestGetProfile(t *testing.T) {
 			},
 			want: response{
 				code: http.StatusOK,
-				body: []byte(`{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"insights":false,"remediations":false,"compliance":false}`),
+				body: []byte(`{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"state":{"compliance_openscap":"disabled","insights":"disabled","remediations":"disabled"},"source":"admin","insights":false,"remediations":false,"compliance":false}`),
 			},
+			wantETag: `"b5db9cbc-4ecd-464b-b416-3a6cd67af87a"`,
 		},
 		{
 			description: "get profile by current",
-			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, insights, remediations, compliance) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', FALSE, FALSE, FALSE), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '` + UNIXTime + `', TRUE, TRUE, TRUE);`),
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
 			input: request{
 				method: http.MethodGet,
 				url:    "/profiles/current",
@@ -103,27 +162,76 @@ func TestGetProfile(t *testing.T) {
 			},
 			want: response{
 				code: http.StatusOK,
-				body: []byte(`{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"insights":false,"remediations":false,"compliance":false}`),
+				body: []byte(`{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"state":{"compliance_openscap":"disabled","insights":"disabled","remediations":"disabled"},"source":"admin","insights":false,"remediations":false,"compliance":false}`),
+			},
+			wantETag: `"b5db9cbc-4ecd-464b-b416-3a6cd67af87a"`,
+		},
+		{
+			description: "get profile belonging to another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find profile with ID: 3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf`),
+			},
+		},
+		{
+			description: "get missing profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/0c3bd5e4-6f49-4c6a-9a8b-4d1b1d0b7b52",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find profile with ID: 0c3bd5e4-6f49-4c6a-9a8b-4d1b1d0b7b52`),
+			},
+		},
+		{
+			description: "get profile with malformed ID",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/not-a-uuid",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+				body: []byte(`cannot parse profile ID: invalid UUID length: 10`),
 			},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := db.Open("pgx", DSN); err != nil {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := db.Close(); err != nil {
+				if err := database.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := db.Migrate(true); err != nil {
+			if err := db.Migrate(database, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := db.SeedData(test.seed); err != nil {
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
 				t.Fatalf("failed to seed database: %v", err)
 			}
 
@@ -136,7 +244,7 @@ func TestGetProfile(t *testing.T) {
 
 			router := chi.NewMux()
 			router.Use(identity.EnforceIdentity)
-			router.Get("/profiles/{id}", getProfile)
+			router.Get("/profiles/{id}", s.getProfile)
 			router.ServeHTTP(rr, req)
 
 			got := response{rr.Code, bytes.TrimSpace(rr.Body.Bytes())}
@@ -144,93 +252,194 @@ func TestGetProfile(t *testing.T) {
 			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{})) {
 				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
 			}
+
+			if got := rr.Header().Get("ETag"); got != test.wantETag {
+				t.Errorf("ETag: %v != %v", got, test.wantETag)
+			}
 		})
 	}
 }
 
-func TestCreateProfile(t *testing.T) {
-	type response struct {
-		code int
-		body map[string]interface{}
-	}
+func TestGetProfiles(t *testing.T) {
+	cursor := db.Cursor{CreatedAt: time.Date(1970, 1, 2, 0, 0, 0, 0, time.UTC), ProfileID: uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf")}.String()
+
 	tests := []struct {
-		description      string
-		seed             []byte
-		ignoreMapEntries func(k string, v interface{}) bool
-		input            request
-		want             response
+		description string
+		seed        []byte
+		input       request
+		want        response
 	}{
 		{
-			description: "new profile values",
-			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, insights, remediations, compliance) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', FALSE, FALSE, FALSE);`),
-			ignoreMapEntries: func(k string, v interface{}) bool {
-				return k == "id" || k == "label" || k == "created_at"
-			},
+			description: "default pagination",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
 			input: request{
 				method: http.MethodGet,
 				url:    "/profiles",
-				body:   []byte(`{"active":true,"insights":true,"compliance":true,"remediations":true}`),
 				headers: map[string]string{
 					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
 				},
 			},
 			want: response{
-				code: http.StatusCreated,
-				body: map[string]interface{}{
-					"account_id":   "10064",
-					"org_id":       "78606",
-					"insights":     true,
-					"compliance":   true,
-					"remediations": true,
-					"active":       true,
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":2,"limit":50,"offset":0},"links":{"first":"/profiles?limit=50\u0026offset=0","last":"/profiles?limit=50\u0026offset=0"},"data":[{"id":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf","account_id":"10064","org_id":"78606","created_at":"1970-01-02T00:00:00Z","active":false,"state":{"compliance_openscap":"enabled","insights":"enabled","remediations":"enabled"},"source":"admin","insights":true,"remediations":true,"compliance":true},{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"state":{"compliance_openscap":"disabled","insights":"disabled","remediations":"disabled"},"source":"admin","insights":false,"remediations":false,"compliance":false}]}`),
+			},
+		},
+		{
+			description: "limit and offset",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10064', '78606', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"disabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?limit=1&offset=1",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
 				},
 			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":3,"limit":1,"offset":1},"links":{"first":"/profiles?limit=1\u0026offset=0","next":"/profiles?limit=1\u0026offset=2","prev":"/profiles?limit=1\u0026offset=0","last":"/profiles?limit=1\u0026offset=2"},"data":[{"id":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf","account_id":"10064","org_id":"78606","created_at":"1970-01-02T00:00:00Z","active":false,"state":{"compliance_openscap":"enabled","insights":"enabled","remediations":"enabled"},"source":"admin","insights":true,"remediations":true,"compliance":true}]}`),
+			},
 		},
 		{
-			description: "identical profile values",
-			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, insights, remediations, compliance) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', FALSE, FALSE, FALSE);`),
-			ignoreMapEntries: func(k string, v interface{}) bool {
-				return k == "label" || k == "created_at"
+			description: "first page by cursor",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?cursor=&limit=1",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":2,"limit":1,"offset":0},"links":{"first":"/profiles?cursor=\u0026limit=1","next":"/profiles?cursor=` + cursor + `\u0026limit=1"},"data":[{"id":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf","account_id":"10064","org_id":"78606","created_at":"1970-01-02T00:00:00Z","active":false,"state":{"compliance_openscap":"enabled","insights":"enabled","remediations":"enabled"},"source":"admin","insights":true,"remediations":true,"compliance":true}]}`),
 			},
+		},
+		{
+			description: "last page by cursor",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
 			input: request{
 				method: http.MethodGet,
-				url:    "/profiles",
-				body:   []byte(`{"active":false,"insights":false,"compliance":false,"remediations":false}`),
+				url:    "/profiles?cursor=" + cursor + "&limit=1",
 				headers: map[string]string{
 					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
 				},
 			},
 			want: response{
-				code: http.StatusNotModified,
-				body: map[string]interface{}{
-					"account_id":   "10064",
-					"org_id":       "78606",
-					"id":           "b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
-					"insights":     false,
-					"compliance":   false,
-					"remediations": false,
-					"active":       false,
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":2,"limit":1,"offset":0},"links":{"first":"/profiles?cursor=\u0026limit=1"},"data":[{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"state":{"compliance_openscap":"disabled","insights":"disabled","remediations":"disabled"},"source":"admin","insights":false,"remediations":false,"compliance":false}]}`),
+			},
+		},
+		{
+			description: "invalid cursor",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?cursor=not-a-cursor",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+				body: []byte(`parse error: 'invalid cursor: not-a-cursor'`),
+			},
+		},
+		{
+			description: "invalid sort_by",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?sort_by=created_at:sideways",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
 				},
 			},
+			want: response{
+				code: http.StatusBadRequest,
+				body: []byte(`parse error: 'invalid order direction: SIDEWAYS'`),
+			},
+		},
+		{
+			description: "filtered by insights",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?insights=true",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":1,"limit":50,"offset":0},"links":{"first":"/profiles?insights=true\u0026limit=50\u0026offset=0","last":"/profiles?insights=true\u0026limit=50\u0026offset=0"},"data":[{"id":"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf","account_id":"10064","org_id":"78606","created_at":"1970-01-02T00:00:00Z","active":false,"state":{"compliance_openscap":"enabled","insights":"enabled","remediations":"enabled"},"source":"admin","insights":true,"remediations":true,"compliance":true}]}`),
+			},
+		},
+		{
+			description: "filtered by creation time and sorted",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?created_before=1970-01-02T00:00:00Z&sort_by=created_at:asc",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":1,"limit":50,"offset":0},"links":{"first":"/profiles?created_before=1970-01-02T00%3A00%3A00Z\u0026limit=50\u0026offset=0\u0026sort_by=created_at%3Aasc","last":"/profiles?created_before=1970-01-02T00%3A00%3A00Z\u0026limit=50\u0026offset=0\u0026sort_by=created_at%3Aasc"},"data":[{"id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","account_id":"10064","org_id":"78606","created_at":"1970-01-01T00:00:00Z","active":false,"state":{"compliance_openscap":"disabled","insights":"disabled","remediations":"disabled"},"source":"admin","insights":false,"remediations":false,"compliance":false}]}`),
+			},
+		},
+		{
+			description: "invalid sort field",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?sort_by=profile_id",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+				body: []byte(`parse error: 'invalid sort field: profile_id'`),
+			},
+		},
+		{
+			description: "invalid filter",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '1970-01-01T00:00:00Z', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '1970-01-02T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'), ('f4e5e7a1-3c5d-4a5f-9d5a-3b1d8c7a0f11', '10065', '78607', '1970-01-03T00:00:00Z', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles?created_after=yesterday",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+				body: []byte(`parse error: 'invalid created_after: yesterday'`),
+			},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			if err := db.Open("pgx", DSN); err != nil {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
 				t.Fatalf("failed to open database: %v", err)
 			}
 			defer func() {
-				if err := db.Close(); err != nil {
+				if err := database.Close(); err != nil {
 					t.Fatalf("failed to close database: %v", err)
 				}
 			}()
 
-			if err := db.Migrate(true); err != nil {
+			if err := db.Migrate(database, true); err != nil {
 				t.Fatalf("failed to migrate database: %v", err)
 			}
 
-			if err := db.SeedData(test.seed); err != nil {
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
 				t.Fatalf("failed to seed database: %v", err)
 			}
 
@@ -243,22 +452,1013 @@ func TestCreateProfile(t *testing.T) {
 
 			router := chi.NewMux()
 			router.Use(identity.EnforceIdentity)
-			router.Get("/profiles", createProfile)
+			router.Get("/profiles", s.getProfiles)
 			router.ServeHTTP(rr, req)
 
-			got := response{rr.Code, map[string]interface{}{}}
+			got := response{rr.Code, bytes.TrimSpace(rr.Body.Bytes())}
 
-			if got.code != test.want.code {
-				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{})) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
 			}
+		})
+	}
+}
 
-			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
-				t.Fatal(err)
+func TestGetHostStatus(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "get status of host",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, created_at, updated_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z'), ('0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f', '78607', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', NULL, 'failure', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/hosts/8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60/status",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"host_id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","profile_id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","run_id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","status":"success","created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z"}`),
+			},
+		},
+		{
+			description: "get status of host in another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, created_at, updated_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z'), ('0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f', '78607', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', NULL, 'failure', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/hosts/0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f/status",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find status for host with ID: 0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f`),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
 			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
 
-			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{}), cmpopts.IgnoreMapEntries(test.ignoreMapEntries)) {
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			reader := bytes.NewReader(test.input.body)
+			req := httptest.NewRequest(test.input.method, test.input.url, reader)
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/hosts/{id}/status", s.getHostStatus)
+			router.ServeHTTP(rr, req)
+
+			got := response{rr.Code, bytes.TrimSpace(rr.Body.Bytes())}
+
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{})) {
 				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
 			}
 		})
 	}
 }
+
+func TestGetProfileHosts(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "get hosts of profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, created_at, updated_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z'), ('0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f', '78607', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', NULL, 'failure', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/hosts",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: []byte(`{"meta":{"count":1,"limit":50,"offset":0},"links":{"first":"/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/hosts?limit=50\u0026offset=0","last":"/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/hosts?limit=50\u0026offset=0"},"data":[{"host_id":"8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60","org_id":"78606","profile_id":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","run_id":"3d711f8b-77d0-4ed5-a5b5-1d282bf930c7","status":"success","created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z"}]}`),
+			},
+		},
+		{
+			description: "get hosts of profile in another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}'); INSERT INTO host_runs (host_id, org_id, profile_id, run_id, status, created_at, updated_at) VALUES ('8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60', '78606', 'b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '3d711f8b-77d0-4ed5-a5b5-1d282bf930c7', 'success', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z'), ('0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f', '78607', '3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', NULL, 'failure', '1970-01-01T00:00:00Z', '1970-01-01T00:00:00Z');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles/3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf/hosts",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find profile with ID: 3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf`),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			reader := bytes.NewReader(test.input.body)
+			req := httptest.NewRequest(test.input.method, test.input.url, reader)
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/profiles/{id}/hosts", s.getProfileHosts)
+			router.ServeHTTP(rr, req)
+
+			got := response{rr.Code, bytes.TrimSpace(rr.Body.Bytes())}
+
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{})) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
+			}
+		})
+	}
+}
+
+func TestCreateProfile(t *testing.T) {
+	type response struct {
+		code int
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description      string
+		seed             []byte
+		ignoreMapEntries func(k string, v interface{}) bool
+		input            request
+		want             response
+		wantApplied      bool
+	}{
+		{
+			description: "new profile values",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}');`),
+			ignoreMapEntries: func(k string, v interface{}) bool {
+				return k == "id" || k == "label" || k == "created_at"
+			},
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles",
+				body:   []byte(`{"active":true,"insights":true,"compliance":true,"remediations":true,"reason":"enable all services"}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusCreated,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"insights":     true,
+					"compliance":   true,
+					"remediations": true,
+					"active":       true,
+					"state":        map[string]interface{}{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+					"principal":    "torque",
+					"reason":       "enable all services",
+					"source":       "api",
+				},
+			},
+			wantApplied: true,
+		},
+		{
+			description: "org without profile",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'base', '{"insights":"enabled","remediations":"disabled","compliance_openscap":"disabled"}', TRUE);`),
+			ignoreMapEntries: func(k string, v interface{}) bool {
+				return k == "id" || k == "label" || k == "created_at"
+			},
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles",
+				body:   []byte(`{"active":true,"state":{"insights":"enabled","remediations":"enabled","compliance_openscap":"disabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusCreated,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"insights":     true,
+					"compliance":   false,
+					"remediations": true,
+					"active":       true,
+					"state":        map[string]interface{}{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "disabled"},
+					"principal":    "torque",
+					"source":       "api",
+				},
+			},
+			wantApplied: true,
+		},
+		{
+			description: "services left out take their default",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}');`),
+			ignoreMapEntries: func(k string, v interface{}) bool {
+				return k == "id" || k == "label" || k == "created_at"
+			},
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles",
+				body:   []byte(`{"active":true,"state":{"insights":"enabled","remediations":"disabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusCreated,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"insights":     true,
+					"compliance":   true,
+					"remediations": false,
+					"active":       true,
+					"state":        map[string]interface{}{"insights": "enabled", "remediations": "disabled", "compliance_openscap": "enabled"},
+					"principal":    "torque",
+					"source":       "api",
+				},
+			},
+			wantApplied: true,
+		},
+		{
+			description: "unsatisfied dependency",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"enabled","remediations":"enabled","compliance_openscap":"disabled"}');`),
+			ignoreMapEntries: func(k string, v interface{}) bool {
+				return k == "message"
+			},
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles",
+				body:   []byte(`{"active":true,"state":{"insights":"disabled","remediations":"enabled","compliance_openscap":"disabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusUnprocessableEntity,
+				body: map[string]interface{}{
+					"violations": []interface{}{
+						map[string]interface{}{
+							"service":        "remediations",
+							"value":          "enabled",
+							"requires":       "insights",
+							"required_value": "enabled",
+							"actual_value":   "disabled",
+						},
+					},
+				},
+			},
+		},
+		{
+			description: "identical profile values",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', '{"insights":"disabled","remediations":"disabled","compliance_openscap":"disabled"}');`),
+			ignoreMapEntries: func(k string, v interface{}) bool {
+				return k == "label" || k == "created_at"
+			},
+			input: request{
+				method: http.MethodGet,
+				url:    "/profiles",
+				body:   []byte(`{"active":false,"insights":false,"compliance":false,"remediations":false}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotModified,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"id":           "b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
+					"insights":     false,
+					"compliance":   false,
+					"remediations": false,
+					"active":       false,
+					"state":        map[string]interface{}{"insights": "disabled", "remediations": "disabled", "compliance_openscap": "disabled"},
+					"source":       "admin",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			reader := bytes.NewReader(test.input.body)
+			req := httptest.NewRequest(test.input.method, test.input.url, reader)
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			applied := make(chan db.Profile, 1)
+			s.applier = &fakeApplier{applied: applied}
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/profiles", s.createProfile)
+			router.ServeHTTP(rr, req)
+
+			got := response{rr.Code, map[string]interface{}{}}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.wantApplied {
+				select {
+				case profile := <-applied:
+					if profile.ID.String() != got.body["id"] {
+						t.Errorf("applied profile %v, created %v", profile.ID, got.body["id"])
+					}
+				case <-time.After(time.Second):
+					t.Errorf("profile was not applied")
+				}
+			}
+
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{}), cmpopts.IgnoreMapEntries(test.ignoreMapEntries)) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
+			}
+		})
+	}
+}
+
+func TestSaveProfileChanged(t *testing.T) {
+	changed := fmt.Errorf("cannot insert profile: %w", db.ErrProfileChanged)
+
+	tests := []struct {
+		description string
+		changes     []db.Profile
+		insertErrs  []error
+		input       request
+		want        int
+		wantInserts int
+		wantState   db.StateMap
+	}{
+		{
+			description: "without If-Match",
+			insertErrs:  []error{changed},
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want:        http.StatusCreated,
+			wantInserts: 2,
+		},
+		{
+			description: "with If-Match",
+			insertErrs:  []error{changed},
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"If-Match":      `"b5db9cbc-4ecd-464b-b416-3a6cd67af87a"`,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want:        http.StatusPreconditionFailed,
+			wantInserts: 1,
+		},
+		{
+			description: "changed to the requested profile",
+			changes:     []db.Profile{{ID: uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"), Active: false, State: db.StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}}},
+			insertErrs:  []error{changed},
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want:        http.StatusNotModified,
+			wantInserts: 1,
+		},
+		{
+			description: "changed on every attempt",
+			insertErrs:  []error{changed, changed, changed, changed, changed},
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want:        http.StatusConflict,
+			wantInserts: maxSaveAttempts,
+		},
+		{
+			description: "patch applied to the latest profile",
+			changes:     []db.Profile{{ID: uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"), Active: true, State: db.StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "disabled"}}},
+			insertErrs:  []error{changed},
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`{"state":{"remediations":"disabled"}}`),
+				headers: map[string]string{
+					"Content-Type":  patch.MediaTypeMergePatch,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want:        http.StatusOK,
+			wantInserts: 2,
+			wantState:   db.StateMap{"insights": "enabled", "remediations": "disabled", "compliance_openscap": "disabled"},
+		},
+		{
+			description: "patch not applicable to the latest profile",
+			changes:     []db.Profile{{ID: uuid.MustParse("3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"), Active: true, State: db.StateMap{"insights": "enabled", "remediations": "disabled", "compliance_openscap": "enabled"}}},
+			insertErrs:  []error{changed},
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`[{"op":"test","path":"/state/remediations","value":"enabled"},{"op":"replace","path":"/state/compliance_openscap","value":"disabled"}]`),
+				headers: map[string]string{
+					"Content-Type":  patch.MediaTypeJSONPatch,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want:        http.StatusConflict,
+			wantInserts: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fake := &fakeRepository{
+				current:    db.Profile{ID: uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"), Active: true, State: db.StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}},
+				changes:    test.changes,
+				insertErrs: test.insertErrs,
+			}
+			s := &server{profiles: fake, applier: &fakeApplier{applied: make(chan db.Profile, 1)}}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Post("/profiles", s.createProfile)
+			router.Patch("/profiles/current", s.patchProfile)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != test.want {
+				t.Errorf("%v != %v (%v)", rr.Code, test.want, rr.Body.String())
+			}
+			if fake.inserts != test.wantInserts {
+				t.Errorf("%v != %v", fake.inserts, test.wantInserts)
+			}
+			if test.wantState != nil && !cmp.Equal(fake.inserted.State, test.wantState) {
+				t.Errorf("%v", cmp.Diff(fake.inserted.State, test.wantState))
+			}
+		})
+	}
+}
+
+// blockingApplier blocks in ApplyProfile until release is closed.
+type blockingApplier struct {
+	release chan struct{}
+}
+
+func (f *blockingApplier) ApplyProfile(ctx context.Context, profile db.Profile, principal string) ([]reconcile.Run, error) {
+	<-f.release
+	return nil, nil
+}
+
+func TestMuxWait(t *testing.T) {
+	applier := &blockingApplier{release: make(chan struct{})}
+	s := &server{
+		profiles: &fakeRepository{current: db.Profile{ID: uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"), Active: true, State: db.StateMap{"insights": "enabled"}}},
+		applier:  applier,
+	}
+	m := &Mux{Mux: chi.NewMux(), server: s}
+	m.Use(identity.EnforceIdentity)
+	m.Post("/profiles", s.createProfile)
+
+	req := httptest.NewRequest(http.MethodPost, "/profiles", bytes.NewReader([]byte(`{"active":false}`)))
+	req.Header.Add("X-Rh-Identity", base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)))
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("%v != %v (%v)", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	if m.Wait(10 * time.Millisecond) {
+		t.Errorf("Wait returned before the profile was applied")
+	}
+	close(applier.release)
+	if !m.Wait(time.Second) {
+		t.Errorf("Wait timed out after the profile was applied")
+	}
+}
+
+func TestPatchProfileRoute(t *testing.T) {
+	tests := []struct {
+		description string
+		input       request
+		want        int
+	}{
+		{
+			description: "current profile",
+			input: request{
+				method: http.MethodPatch,
+				url:    "/api/config-manager/v2/profiles/current",
+				body:   []byte(`{"active":true}`),
+				headers: map[string]string{
+					"Content-Type":  patch.MediaTypeMergePatch,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: http.StatusNotModified,
+		},
+		{
+			description: "profile ID",
+			input: request{
+				method: http.MethodPatch,
+				url:    "/api/config-manager/v2/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
+				body:   []byte(`{"active":true}`),
+				headers: map[string]string{
+					"Content-Type":  patch.MediaTypeMergePatch,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			description: "get current profile",
+			input: request{
+				method: http.MethodGet,
+				url:    "/api/config-manager/v2/profiles/current",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: http.StatusOK,
+		},
+	}
+
+	spec, err := GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	openapi3filter.RegisterBodyDecoder(patch.MediaTypeMergePatch, openapi3filter.JSONBodyDecoder)
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			s := &server{
+				profiles: &fakeRepository{current: db.Profile{ID: uuid.MustParse("b5db9cbc-4ecd-464b-b416-3a6cd67af87a"), Active: true, State: db.StateMap{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"}}},
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			v2r := chi.NewMux()
+			v2r.Use(identity.EnforceIdentity)
+			v2r.Use(oapimiddleware.OapiRequestValidator(spec))
+			v2r.Get("/profiles/{id}", s.getProfile)
+			v2r.Patch("/profiles/current", s.patchProfile)
+
+			router := chi.NewMux()
+			router.Mount("/api/config-manager/v2", v2r)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != test.want {
+				t.Errorf("%v != %v (%v)", rr.Code, test.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchProfile(t *testing.T) {
+	type response struct {
+		code int
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "merge patch",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`{"state":{"compliance_openscap":"disabled"},"reason":"compliance audit finished"}`),
+				headers: map[string]string{
+					"Content-Type":  "application/merge-patch+json",
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"active":       true,
+					"state":        map[string]interface{}{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "disabled"},
+					"insights":     true,
+					"remediations": true,
+					"compliance":   false,
+					"principal":    "torque",
+					"reason":       "compliance audit finished",
+					"source":       "api",
+				},
+			},
+		},
+		{
+			description: "JSON patch",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`[{"op":"test","path":"/active","value":true},{"op":"replace","path":"/active","value":false}]`),
+				headers: map[string]string{
+					"Content-Type":  "application/json-patch+json",
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"active":       false,
+					"state":        map[string]interface{}{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+					"insights":     true,
+					"remediations": true,
+					"compliance":   true,
+					"principal":    "torque",
+					"source":       "api",
+				},
+			},
+		},
+		{
+			description: "failed JSON patch test",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`[{"op":"test","path":"/active","value":false},{"op":"replace","path":"/active","value":true}]`),
+				headers: map[string]string{
+					"Content-Type":  "application/json-patch+json",
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			description: "unknown field",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`{"insights":false}`),
+				headers: map[string]string{
+					"Content-Type":  "application/merge-patch+json",
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			description: "matching If-Match",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"Content-Type":  "application/merge-patch+json",
+					"If-Match":      `"b5db9cbc-4ecd-464b-b416-3a6cd67af87a"`,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"account_id":   "10064",
+					"org_id":       "78606",
+					"active":       false,
+					"state":        map[string]interface{}{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+					"insights":     true,
+					"remediations": true,
+					"compliance":   true,
+					"principal":    "torque",
+					"source":       "api",
+				},
+			},
+		},
+		{
+			description: "mismatched If-Match",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"Content-Type":  "application/merge-patch+json",
+					"If-Match":      `"3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf"`,
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusPreconditionFailed,
+			},
+		},
+		{
+			description: "unsupported media type",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPatch,
+				url:    "/profiles/current",
+				body:   []byte(`{"active":false}`),
+				headers: map[string]string{
+					"Content-Type":  "application/json",
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusUnsupportedMediaType,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			s.applier = &fakeApplier{applied: make(chan db.Profile, 1)}
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Patch("/profiles/current", s.patchProfile)
+			router.ServeHTTP(rr, req)
+
+			got := response{code: rr.Code}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if test.want.body == nil {
+				return
+			}
+
+			got.body = map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			ignore := cmpopts.IgnoreMapEntries(func(k string, v interface{}) bool {
+				return k == "id" || k == "created_at"
+			})
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{}), ignore) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{}), ignore))
+			}
+		})
+	}
+}
+
+func TestRestoreProfile(t *testing.T) {
+	type response struct {
+		code int
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "restore previous profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', NOW(), TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles/b5db9cbc-4ecd-464b-b416-3a6cd67af87a/restore",
+				body:   []byte(`{"reason":"revert outage"}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusCreated,
+				body: map[string]interface{}{
+					"account_id":    "10064",
+					"org_id":        "78606",
+					"active":        true,
+					"state":         map[string]interface{}{"insights": "enabled", "remediations": "disabled", "compliance_openscap": "disabled"},
+					"restored_from": "b5db9cbc-4ecd-464b-b416-3a6cd67af87a",
+					"principal":     "torque",
+					"reason":        "revert outage",
+					"source":        "restore",
+					"insights":      true,
+					"remediations":  false,
+					"compliance":    false,
+				},
+			},
+		},
+		{
+			description: "restore current profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', NOW(), TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles/3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf/restore",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotModified,
+			},
+		},
+		{
+			description: "restore missing profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, active, state) VALUES ('b5db9cbc-4ecd-464b-b416-3a6cd67af87a', '10064', '78606', '` + UNIXTime + `', TRUE, '{"insights":"enabled","remediations":"disabled","compliance_openscap":"disabled"}'), ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', NOW(), TRUE, '{"insights":"enabled","remediations":"enabled","compliance_openscap":"enabled"}');`),
+			input: request{
+				method: http.MethodPost,
+				url:    "/profiles/0c3bd5e4-6f49-4c6a-9a8b-4d1b1d0b7b52/restore",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			s.applier = &fakeApplier{applied: make(chan db.Profile, 1)}
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Post("/profiles/{id}/restore", s.restoreProfile)
+			router.ServeHTTP(rr, req)
+
+			got := response{code: rr.Code}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if test.want.body == nil {
+				return
+			}
+
+			got.body = map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			ignore := cmpopts.IgnoreMapEntries(func(k string, v interface{}) bool {
+				return k == "id" || k == "created_at"
+			})
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{}), ignore) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{}), ignore))
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package v2
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+// Meta describes the result set of a paginated response.
+type Meta struct {
+	Count  int `json:"count"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// Links contains relative URLs to the pages of a paginated response. Next and
+// Prev are omitted when there is no such page. Responses paginated by cursor
+// only link to the first and next pages.
+type Links struct {
+	First string `json:"first"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// parsePagination reads the "limit" and "offset" query parameters from r,
+// falling back to defaults when a parameter is absent.
+func parsePagination(r *http.Request) (limit int, offset int, err error) {
+	limit = defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("invalid limit: %v", v)
+		}
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %v", v)
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// newLinks builds the pagination links for a result set of count items,
+// preserving any other query parameters present on u.
+func newLinks(u *url.URL, limit int, offset int, count int) Links {
+	page := func(offset int) string {
+		q := u.Query()
+		q.Set("limit", strconv.Itoa(limit))
+		q.Set("offset", strconv.Itoa(offset))
+		return (&url.URL{Path: u.Path, RawQuery: q.Encode()}).String()
+	}
+
+	last := 0
+	if count > 0 {
+		last = ((count - 1) / limit) * limit
+	}
+
+	links := Links{
+		First: page(0),
+		Last:  page(last),
+	}
+
+	if offset+limit < count {
+		links.Next = page(offset + limit)
+	}
+
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links.Prev = page(prev)
+	}
+
+	return links
+}
+
+// newCursorLinks builds the pagination links for a page of a result set
+// paginated by cursor, preserving any other query parameters present on u. If
+// next is empty, the page is the last one.
+func newCursorLinks(u *url.URL, limit int, next string) Links {
+	page := func(cursor string) string {
+		q := u.Query()
+		q.Set("limit", strconv.Itoa(limit))
+		q.Set("cursor", cursor)
+		return (&url.URL{Path: u.Path, RawQuery: q.Encode()}).String()
+	}
+
+	links := Links{
+		First: page(""),
+	}
+
+	if next != "" {
+		links.Next = page(next)
+	}
+
+	return links
+}
@@ -0,0 +1,197 @@
+package v2
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePagination(t *testing.T) {
+	type pagination struct {
+		limit  int
+		offset int
+	}
+
+	tests := []struct {
+		description string
+		input       string
+		want        pagination
+		wantError   bool
+	}{
+		{
+			description: "defaults",
+			input:       "/profiles",
+			want:        pagination{limit: defaultLimit, offset: 0},
+		},
+		{
+			description: "limit and offset",
+			input:       "/profiles?limit=10&offset=20",
+			want:        pagination{limit: 10, offset: 20},
+		},
+		{
+			description: "limit too large",
+			input:       "/profiles?limit=1000",
+			wantError:   true,
+		},
+		{
+			description: "negative offset",
+			input:       "/profiles?offset=-1",
+			wantError:   true,
+		},
+		{
+			description: "non-numeric limit",
+			input:       "/profiles?limit=ten",
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var got pagination
+			var err error
+			got.limit, got.offset, err = parsePagination(httptest.NewRequest("GET", test.input, nil))
+
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(pagination{})) {
+				t.Errorf("%#v != %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewLinks(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			url                  string
+			limit, offset, count int
+		}
+		want Links
+	}{
+		{
+			description: "empty result set",
+			input: struct {
+				url                  string
+				limit, offset, count int
+			}{url: "/profiles", limit: 10, offset: 0, count: 0},
+			want: Links{
+				First: "/profiles?limit=10&offset=0",
+				Last:  "/profiles?limit=10&offset=0",
+			},
+		},
+		{
+			description: "first page",
+			input: struct {
+				url                  string
+				limit, offset, count int
+			}{url: "/profiles", limit: 10, offset: 0, count: 25},
+			want: Links{
+				First: "/profiles?limit=10&offset=0",
+				Next:  "/profiles?limit=10&offset=10",
+				Last:  "/profiles?limit=10&offset=20",
+			},
+		},
+		{
+			description: "middle page",
+			input: struct {
+				url                  string
+				limit, offset, count int
+			}{url: "/profiles", limit: 10, offset: 10, count: 25},
+			want: Links{
+				First: "/profiles?limit=10&offset=0",
+				Next:  "/profiles?limit=10&offset=20",
+				Prev:  "/profiles?limit=10&offset=0",
+				Last:  "/profiles?limit=10&offset=20",
+			},
+		},
+		{
+			description: "unaligned offset",
+			input: struct {
+				url                  string
+				limit, offset, count int
+			}{url: "/profiles?sort_by=created_at:asc", limit: 10, offset: 5, count: 20},
+			want: Links{
+				First: "/profiles?limit=10&offset=0&sort_by=created_at%3Aasc",
+				Next:  "/profiles?limit=10&offset=15&sort_by=created_at%3Aasc",
+				Prev:  "/profiles?limit=10&offset=0&sort_by=created_at%3Aasc",
+				Last:  "/profiles?limit=10&offset=10&sort_by=created_at%3Aasc",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			u, err := url.Parse(test.input.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := newLinks(u, test.input.limit, test.input.offset, test.input.count)
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestNewCursorLinks(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			url   string
+			limit int
+			next  string
+		}
+		want Links
+	}{
+		{
+			description: "last page",
+			input: struct {
+				url   string
+				limit int
+				next  string
+			}{url: "/profiles?cursor=abc", limit: 10},
+			want: Links{
+				First: "/profiles?cursor=&limit=10",
+			},
+		},
+		{
+			description: "next page",
+			input: struct {
+				url   string
+				limit int
+				next  string
+			}{url: "/profiles?cursor=", limit: 10, next: "abc"},
+			want: Links{
+				First: "/profiles?cursor=&limit=10",
+				Next:  "/profiles?cursor=abc&limit=10",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			u, err := url.Parse(test.input.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := newCursorLinks(u, test.input.limit, test.input.next)
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package v2
+
+import (
+	"config-manager/internal/config"
+	"config-manager/internal/http/render"
+	"config-manager/internal/instrumentation"
+	"config-manager/internal/playbook"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+	"github.com/rs/zerolog/log"
+)
+
+// getPlaybook returns the playbook that applies the profile identified by the
+// "profile_id" query parameter, restricted to the profiles of the org of the
+// identity defined by the X-Rh-Identity header. Hosts fetch it from the URL
+// of the runs created by reconcile.
+func (s *server) getPlaybook(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	profileID := r.URL.Query().Get("profile_id")
+	if _, err := uuid.Parse(profileID); err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot parse profile ID: %v", err), logger)
+		return
+	}
+
+	profile, err := s.profiles.GetProfile(r.Context(), id.Identity.OrgID, profileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find profile with ID: %v", profileID), logger)
+			return
+		}
+		instrumentation.PlaybookRequestError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get profile: %v", err), logger)
+		return
+	}
+
+	data, err := playbook.Generate(playbook.Sources(config.DefaultConfig.PlaybookFiles), profile.StateConfig())
+	if err != nil {
+		instrumentation.PlaybookRequestError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot generate playbook: %v", err), logger)
+		return
+	}
+
+	instrumentation.PlaybookRequestOK()
+	w.Header().Set("Content-Type", "text/vnd.yaml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(data)); err != nil {
+		logger.Error().Err(err).Msg("cannot write playbook")
+		return
+	}
+	logger.Debug().Int("status_code", http.StatusOK).Msg("sent HTTP response")
+}
@@ -0,0 +1,122 @@
+package v2
+
+import (
+	"bytes"
+	"config-manager/internal/db"
+	"config-manager/internal/playbook"
+	"encoding/base64"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+)
+
+func TestGetPlaybook(t *testing.T) {
+	// The playbooks embedded in the binary are the ones served.
+	read := func(name string) string {
+		data, err := fs.ReadFile(playbook.Sources(""), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimPrefix(string(data), "---\n")
+	}
+
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "playbook of profile",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '` + UNIXTime + `', '{"insights":"enabled","remediations":"disabled"}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/playbooks?profile_id=3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"cert-auth","internal":{"org_id":"78606"},"org_id":"78606","type":"System","system":{"cn":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","cert_type":"system"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: bytes.TrimSpace([]byte("---\n" + read("compliance_openscap_setup.yml") + read("insights_setup.yml") + read("remediations_remove.yml"))),
+			},
+		},
+		{
+			description: "profile belonging to another org",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10065', '78607', '` + UNIXTime + `', '{}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/playbooks?profile_id=3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"cert-auth","internal":{"org_id":"78606"},"org_id":"78606","type":"System","system":{"cn":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","cert_type":"system"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+				body: []byte(`cannot find profile with ID: 3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf`),
+			},
+		},
+		{
+			description: "invalid profile ID",
+			seed:        []byte(`INSERT INTO profiles (profile_id, account_id, org_id, created_at, state) VALUES ('3c8859ae-ef4e-4136-ab17-ccd4ea9f36bf', '10064', '78606', '` + UNIXTime + `', '{}');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/playbooks?profile_id=current",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"cert-auth","internal":{"org_id":"78606"},"org_id":"78606","type":"System","system":{"cn":"b5db9cbc-4ecd-464b-b416-3a6cd67af87a","cert_type":"system"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+				body: []byte(`cannot parse profile ID: invalid UUID length: 7`),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/playbooks", s.getPlaybook)
+			router.ServeHTTP(rr, req)
+
+			got := response{rr.Code, bytes.TrimSpace(rr.Body.Bytes())}
+
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{})) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{})))
+			}
+		})
+	}
+}
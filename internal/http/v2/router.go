@@ -2,13 +2,18 @@ package v2
 
 import (
 	"config-manager/internal/config"
+	"config-manager/internal/db"
 	"config-manager/internal/http/middleware/authorization"
 	"config-manager/internal/http/render"
+	"config-manager/internal/patch"
+	"config-manager/internal/util"
 	"fmt"
 	"net/http"
 	"path"
+	"time"
 
 	oapimiddleware "github.com/deepmap/oapi-codegen/pkg/chi-middleware"
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httplog"
@@ -18,12 +23,31 @@ import (
 
 //go:generate oapi-codegen -config oapi-codegen.yml ./openapi.json
 
-func NewMux() (*chi.Mux, error) {
+// Mux is the router of the v2 API.
+type Mux struct {
+	*chi.Mux
+	server *server
+}
+
+// Wait waits up to timeout for the profiles saved by requests to be applied to
+// hosts. It returns false if it timed out.
+func (m *Mux) Wait(timeout time.Duration) bool {
+	return util.WaitTimeout(&m.server.applies, timeout)
+}
+
+// NewMux creates the router of the v2 API, which reads and creates profiles in
+// profiles, host runs in hostRuns and templates in templates, and applies new
+// profiles to hosts with applier.
+func NewMux(profiles db.ProfileRepository, hostRuns db.HostRunRepository, templates db.TemplateRepository, applier ProfileApplier) (*Mux, error) {
 	spec, err := GetSwagger()
 	if err != nil {
 		return nil, fmt.Errorf("cannot get OpenAPI spec: %w", err)
 	}
 
+	// kin-openapi decodes JSON Patch documents but not JSON Merge Patch
+	// documents out of the box.
+	openapi3filter.RegisterBodyDecoder(patch.MediaTypeMergePatch, openapi3filter.JSONBodyDecoder)
+
 	router := chi.NewMux()
 
 	router.Use(httplog.RequestLogger(httplog.NewLogger("v2", httplog.Options{
@@ -38,19 +62,43 @@ func NewMux() (*chi.Mux, error) {
 
 	kessel := authorization.NewKesselClient(config.DefaultConfig)
 
+	s := &server{
+		profiles:  profiles,
+		hostRuns:  hostRuns,
+		templates: templates,
+		applier:   applier,
+	}
+
 	router.Route("/", func(r chi.Router) {
 		r.Use(oapimiddleware.OapiRequestValidator(spec))
 
+		// Hosts fetch playbooks with their own identity, which is not
+		// granted workspace permissions.
+		r.Get("/playbooks", s.getPlaybook)
+
 		r.Group(func(r chi.Router) {
 			r.Use(kessel.EnforceDefaultWorkspacePermission("config_manager_profile_view"))
-			r.Get("/profiles/{id}", getProfile)
+			r.Get("/profiles", s.getProfiles)
+			// GET /profiles/current is served by getProfile too.
+			r.Get("/profiles/{id}", s.getProfile)
+			r.Get("/profiles/{id}/hosts", s.getProfileHosts)
+			r.Get("/profiles/{id}/diff", s.getProfileDiff)
+			r.Get("/hosts/{id}/status", s.getHostStatus)
+			r.Get("/services", getServices)
+			r.Get("/templates", s.getTemplates)
+			r.Get("/templates/{name}", s.getTemplate)
 		})
 
 		r.Group(func(r chi.Router) {
 			r.Use(kessel.EnforceDefaultWorkspacePermissionForUpdate("config_manager_profile_edit"))
-			r.Post("/profiles", createProfile)
+			r.Post("/profiles", s.createProfile)
+			r.Patch("/profiles/current", s.patchProfile)
+			r.Post("/profiles/{id}/restore", s.restoreProfile)
+			r.Post("/templates", s.createTemplate)
+			r.Put("/templates/{name}", s.updateTemplate)
+			r.Delete("/templates/{name}", s.deleteTemplate)
 		})
 	})
 
-	return router, nil
+	return &Mux{Mux: router, server: s}, nil
 }
@@ -0,0 +1,17 @@
+package v2
+
+import (
+	"config-manager/internal/catalog"
+	"config-manager/internal/http/render"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// getServices returns the service catalog.
+func getServices(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	render.RenderJSON(w, r, http.StatusOK, catalog.Services(), logger)
+}
@@ -0,0 +1,34 @@
+package v2
+
+import (
+	"config-manager/internal/catalog"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetServices(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/services", nil)
+	rr := httptest.NewRecorder()
+
+	router := chi.NewMux()
+	router.Get("/services", getServices)
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("%v != %v (%v)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var got []catalog.Service
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(got, catalog.Services()) {
+		t.Errorf("%v", cmp.Diff(got, catalog.Services()))
+	}
+}
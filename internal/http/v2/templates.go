@@ -0,0 +1,272 @@
+package v2
+
+import (
+	"config-manager/internal/catalog"
+	"config-manager/internal/db"
+	"config-manager/internal/http/render"
+	"config-manager/internal/instrumentation"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateList is the paginated response body returned by getTemplates.
+type TemplateList struct {
+	Meta  Meta          `json:"meta"`
+	Links Links         `json:"links"`
+	Data  []db.Template `json:"data"`
+}
+
+// getTemplates returns a paginated list of the profile templates belonging to
+// the org of the identity defined by the X-Rh-Identity header.
+func (s *server) getTemplates(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		instrumentation.GetTemplatesError()
+		render.RenderPlain(w, r, http.StatusBadRequest, err.Error(), logger)
+		return
+	}
+
+	templates, err := s.templates.GetTemplates(r.Context(), id.Identity.OrgID, limit, offset)
+	if err != nil {
+		instrumentation.GetTemplatesError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get templates: %v", err), logger)
+		return
+	}
+
+	count, err := s.templates.CountTemplates(r.Context(), id.Identity.OrgID)
+	if err != nil {
+		instrumentation.GetTemplatesError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot count templates: %v", err), logger)
+		return
+	}
+
+	response := TemplateList{
+		Meta: Meta{
+			Count:  count,
+			Limit:  limit,
+			Offset: offset,
+		},
+		Links: newLinks(r.URL, limit, offset, count),
+		Data:  templates,
+	}
+
+	render.RenderJSON(w, r, http.StatusOK, response, logger)
+}
+
+// templateETag returns the entity tag of template. Templates are updated in
+// place, so the tag is derived from the time of the last update.
+func templateETag(template db.Template) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(template.UpdatedAt.UnixMicro(), 10))
+}
+
+// getTemplate returns the profile template identified by the "name" path
+// parameter, restricted to the templates of the org of the identity defined by
+// the X-Rh-Identity header.
+func (s *server) getTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	name := chi.URLParam(r, "name")
+
+	template, err := s.templates.GetTemplate(r.Context(), id.Identity.OrgID, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find template with name: %v", name), logger)
+			return
+		}
+		instrumentation.GetTemplateError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get template: %v", err), logger)
+		return
+	}
+
+	w.Header().Set("ETag", templateETag(*template))
+	render.RenderJSON(w, r, http.StatusOK, template, logger)
+}
+
+// createTemplate creates and inserts a profile template. If the template is
+// the default, it seeds the first profile of the org from then on.
+func (s *server) createTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		instrumentation.CreateTemplateError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot read request body: %v", err), logger)
+		return
+	}
+	defer r.Body.Close()
+
+	var template db.Template
+	if err := json.Unmarshal(data, &template); err != nil {
+		instrumentation.CreateTemplateError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot unmarshal data: %v", err), logger)
+		return
+	}
+	template.OrgID = id.Identity.OrgID
+
+	if err := catalog.Validate(template.State); err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("invalid state: %v", err), logger)
+		return
+	}
+
+	if violations := catalog.Check(template.State); len(violations) > 0 {
+		renderViolations(w, r, violations, logger)
+		return
+	}
+
+	if err := s.templates.InsertTemplate(r.Context(), template); err != nil {
+		if errors.Is(err, db.ErrTemplateExists) {
+			render.RenderPlain(w, r, http.StatusConflict, fmt.Sprintf("template already exists with name: %v", template.Name), logger)
+			return
+		}
+		if errors.Is(err, db.ErrDefaultTemplateChanged) {
+			render.RenderPlain(w, r, http.StatusConflict, "another default template was set concurrently", logger)
+			return
+		}
+		instrumentation.CreateTemplateError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot insert template: %v", err), logger)
+		return
+	}
+
+	created, err := s.templates.GetTemplate(r.Context(), template.OrgID, template.Name)
+	if err != nil {
+		instrumentation.CreateTemplateError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get template: %v", err), logger)
+		return
+	}
+
+	w.Header().Set("ETag", templateETag(*created))
+	render.RenderJSON(w, r, http.StatusCreated, created, logger)
+}
+
+// updateTemplate replaces the state and default flag of the profile template
+// identified by the "name" path parameter. If the request has an If-Match
+// header, the template is only replaced if it was not updated since the entity
+// tag was returned.
+func (s *server) updateTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	name := chi.URLParam(r, "name")
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		instrumentation.UpdateTemplateError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot read request body: %v", err), logger)
+		return
+	}
+	defer r.Body.Close()
+
+	var template db.Template
+	if err := json.Unmarshal(data, &template); err != nil {
+		instrumentation.UpdateTemplateError()
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("cannot unmarshal data: %v", err), logger)
+		return
+	}
+	template.OrgID = id.Identity.OrgID
+	template.Name = name
+
+	if err := catalog.Validate(template.State); err != nil {
+		render.RenderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("invalid state: %v", err), logger)
+		return
+	}
+
+	if violations := catalog.Check(template.State); len(violations) > 0 {
+		renderViolations(w, r, violations, logger)
+		return
+	}
+
+	// Without If-Match the template is replaced whenever it was updated.
+	var updatedAt time.Time
+	if r.Header.Get("If-Match") != "" {
+		current, err := s.templates.GetTemplate(r.Context(), template.OrgID, name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find template with name: %v", name), logger)
+				return
+			}
+			instrumentation.UpdateTemplateError()
+			render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot get template: %v", err), logger)
+			return
+		}
+
+		if !ifMatch(r, templateETag(*current)) {
+			w.Header().Set("ETag", templateETag(*current))
+			render.RenderPlain(w, r, http.StatusPreconditionFailed, fmt.Sprintf("template does not match If-Match: %v", r.Header.Get("If-Match")), logger)
+			return
+		}
+		updatedAt = current.UpdatedAt
+	}
+
+	updated, err := s.templates.UpdateTemplate(r.Context(), template, updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find template with name: %v", name), logger)
+			return
+		}
+		if errors.Is(err, db.ErrTemplateChanged) {
+			render.RenderPlain(w, r, http.StatusPreconditionFailed, fmt.Sprintf("template does not match If-Match: %v", r.Header.Get("If-Match")), logger)
+			return
+		}
+		if errors.Is(err, db.ErrDefaultTemplateChanged) {
+			render.RenderPlain(w, r, http.StatusConflict, "another default template was set concurrently", logger)
+			return
+		}
+		instrumentation.UpdateTemplateError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot update template: %v", err), logger)
+		return
+	}
+
+	w.Header().Set("ETag", templateETag(*updated))
+	render.RenderJSON(w, r, http.StatusOK, updated, logger)
+}
+
+// deleteTemplate deletes the profile template identified by the "name" path
+// parameter. Profiles seeded from the template are not affected.
+func (s *server) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Logger()
+	logger = logger.With().Str("path", r.URL.Path).Str("method", r.Method).Logger()
+
+	id := identity.GetIdentity(r.Context())
+	logger = logger.With().Interface("identity", id).Logger()
+
+	name := chi.URLParam(r, "name")
+
+	if err := s.templates.DeleteTemplate(r.Context(), id.Identity.OrgID, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.RenderPlain(w, r, http.StatusNotFound, fmt.Sprintf("cannot find template with name: %v", name), logger)
+			return
+		}
+		instrumentation.DeleteTemplateError()
+		render.RenderPlain(w, r, http.StatusInternalServerError, fmt.Sprintf("cannot delete template: %v", err), logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,649 @@
+package v2
+
+import (
+	"bytes"
+	"config-manager/internal/db"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
+)
+
+func TestCreateTemplate(t *testing.T) {
+	type response struct {
+		code int
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "new template",
+			input: request{
+				method: http.MethodPost,
+				url:    "/templates",
+				body:   []byte(`{"name":"rhc","state":{"insights":"enabled","remediations":"disabled"},"default":true}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusCreated,
+				body: map[string]interface{}{
+					"org_id":  "78606",
+					"name":    "rhc",
+					"state":   map[string]interface{}{"insights": "enabled", "remediations": "disabled"},
+					"default": true,
+				},
+			},
+		},
+		{
+			description: "duplicate name",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"disabled"}', FALSE);`),
+			input: request{
+				method: http.MethodPost,
+				url:    "/templates",
+				body:   []byte(`{"name":"rhc","state":{"insights":"enabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusConflict,
+			},
+		},
+		{
+			description: "invalid state",
+			input: request{
+				method: http.MethodPost,
+				url:    "/templates",
+				body:   []byte(`{"name":"rhc","state":{"insights":"on"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Post("/templates", s.createTemplate)
+			router.ServeHTTP(rr, req)
+
+			got := response{code: rr.Code}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if test.want.body == nil {
+				return
+			}
+
+			got.body = map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			ignore := cmpopts.IgnoreMapEntries(func(k string, v interface{}) bool {
+				return k == "created_at" || k == "updated_at"
+			})
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(response{}), ignore) {
+				t.Errorf("%v", cmp.Diff(got, test.want, cmp.AllowUnexported(response{}), ignore))
+			}
+		})
+	}
+}
+
+func TestDeleteTemplate(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        int
+	}{
+		{
+			description: "existing template",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"disabled"}', TRUE);`),
+			input: request{
+				method: http.MethodDelete,
+				url:    "/templates/rhc",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: http.StatusNoContent,
+		},
+		{
+			description: "template belonging to another org",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78607', 'rhc', '{"insights":"disabled"}', TRUE);`),
+			input: request{
+				method: http.MethodDelete,
+				url:    "/templates/rhc",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, nil)
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Delete("/templates/{name}", s.deleteTemplate)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != test.want {
+				t.Errorf("%v != %v (%v)", rr.Code, test.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	type response struct {
+		code int
+		etag string
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "existing template",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default, created_at, updated_at) VALUES ('78606', 'rhc', '{"insights":"enabled"}', TRUE, '` + UNIXTime + `', '` + UNIXTime + `');`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/templates/rhc",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				etag: `"0"`,
+				body: map[string]interface{}{
+					"org_id":  "78606",
+					"name":    "rhc",
+					"state":   map[string]interface{}{"insights": "enabled"},
+					"default": true,
+				},
+			},
+		},
+		{
+			description: "template belonging to another org",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78607', 'rhc', '{"insights":"enabled"}', TRUE);`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/templates/rhc",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, nil)
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/templates/{name}", s.getTemplate)
+			router.ServeHTTP(rr, req)
+
+			got := response{code: rr.Code, etag: rr.Header().Get("ETag")}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if test.want.body == nil {
+				if got.etag != test.want.etag {
+					t.Errorf("%v != %v", got.etag, test.want.etag)
+				}
+				return
+			}
+
+			got.body = map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			ignore := cmpopts.IgnoreMapEntries(func(k string, v interface{}) bool {
+				return k == "created_at" || k == "updated_at"
+			})
+			opts := []cmp.Option{cmp.AllowUnexported(response{}), ignore}
+			if test.want.etag == "" {
+				opts = append(opts, cmpopts.IgnoreFields(response{}, "etag"))
+			}
+			if !cmp.Equal(got, test.want, opts...) {
+				t.Errorf("%v", cmp.Diff(got, test.want, opts...))
+			}
+		})
+	}
+}
+
+func TestGetTemplates(t *testing.T) {
+	type response struct {
+		code int
+		etag string
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "templates sorted by name",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"enabled"}', TRUE), ('78606', 'base', '{"insights":"disabled"}', FALSE), ('78607', 'other', '{"insights":"enabled"}', TRUE);`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/templates",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"meta": map[string]interface{}{"count": 2.0, "limit": 50.0, "offset": 0.0},
+					"links": map[string]interface{}{
+						"first": "/templates?limit=50&offset=0",
+						"last":  "/templates?limit=50&offset=0",
+					},
+					"data": []interface{}{
+						map[string]interface{}{"org_id": "78606", "name": "base", "state": map[string]interface{}{"insights": "disabled"}, "default": false},
+						map[string]interface{}{"org_id": "78606", "name": "rhc", "state": map[string]interface{}{"insights": "enabled"}, "default": true},
+					},
+				},
+			},
+		},
+		{
+			description: "second page",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"enabled"}', TRUE), ('78606', 'base', '{"insights":"disabled"}', FALSE);`),
+			input: request{
+				method: http.MethodGet,
+				url:    "/templates?limit=1&offset=1",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"meta": map[string]interface{}{"count": 2.0, "limit": 1.0, "offset": 1.0},
+					"links": map[string]interface{}{
+						"first": "/templates?limit=1&offset=0",
+						"prev":  "/templates?limit=1&offset=0",
+						"last":  "/templates?limit=1&offset=1",
+					},
+					"data": []interface{}{
+						map[string]interface{}{"org_id": "78606", "name": "rhc", "state": map[string]interface{}{"insights": "enabled"}, "default": true},
+					},
+				},
+			},
+		},
+		{
+			description: "invalid limit",
+			input: request{
+				method: http.MethodGet,
+				url:    "/templates?limit=-1",
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, nil)
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Get("/templates", s.getTemplates)
+			router.ServeHTTP(rr, req)
+
+			got := response{code: rr.Code, etag: rr.Header().Get("ETag")}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if test.want.body == nil {
+				if got.etag != test.want.etag {
+					t.Errorf("%v != %v", got.etag, test.want.etag)
+				}
+				return
+			}
+
+			got.body = map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			ignore := cmpopts.IgnoreMapEntries(func(k string, v interface{}) bool {
+				return k == "created_at" || k == "updated_at"
+			})
+			opts := []cmp.Option{cmp.AllowUnexported(response{}), ignore}
+			if test.want.etag == "" {
+				opts = append(opts, cmpopts.IgnoreFields(response{}, "etag"))
+			}
+			if !cmp.Equal(got, test.want, opts...) {
+				t.Errorf("%v", cmp.Diff(got, test.want, opts...))
+			}
+		})
+	}
+}
+
+func TestUpdateTemplate(t *testing.T) {
+	type response struct {
+		code int
+		etag string
+		body map[string]interface{}
+	}
+	tests := []struct {
+		description string
+		seed        []byte
+		input       request
+		want        response
+	}{
+		{
+			description: "existing template",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"disabled"}', FALSE);`),
+			input: request{
+				method: http.MethodPut,
+				url:    "/templates/rhc",
+				body:   []byte(`{"state":{"insights":"enabled","remediations":"enabled"},"default":true}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"org_id":  "78606",
+					"name":    "rhc",
+					"state":   map[string]interface{}{"insights": "enabled", "remediations": "enabled"},
+					"default": true,
+				},
+			},
+		},
+		{
+			description: "matching If-Match",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default, created_at, updated_at) VALUES ('78606', 'rhc', '{"insights":"disabled"}', FALSE, '` + UNIXTime + `', '` + UNIXTime + `');`),
+			input: request{
+				method: http.MethodPut,
+				url:    "/templates/rhc",
+				body:   []byte(`{"state":{"insights":"enabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+					"If-Match":      `"0"`,
+				},
+			},
+			want: response{
+				code: http.StatusOK,
+				body: map[string]interface{}{
+					"org_id":  "78606",
+					"name":    "rhc",
+					"state":   map[string]interface{}{"insights": "enabled"},
+					"default": false,
+				},
+			},
+		},
+		{
+			description: "template updated since If-Match",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default, created_at, updated_at) VALUES ('78606', 'rhc', '{"insights":"disabled"}', FALSE, '` + UNIXTime + `', '` + UNIXTime + `');`),
+			input: request{
+				method: http.MethodPut,
+				url:    "/templates/rhc",
+				body:   []byte(`{"state":{"insights":"enabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+					"If-Match":      `"1"`,
+				},
+			},
+			want: response{
+				code: http.StatusPreconditionFailed,
+				etag: `"0"`,
+			},
+		},
+		{
+			description: "missing template with If-Match",
+			input: request{
+				method: http.MethodPut,
+				url:    "/templates/rhc",
+				body:   []byte(`{"state":{"insights":"enabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+					"If-Match":      `"0"`,
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+			},
+		},
+		{
+			description: "template belonging to another org",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78607', 'rhc', '{"insights":"disabled"}', FALSE);`),
+			input: request{
+				method: http.MethodPut,
+				url:    "/templates/rhc",
+				body:   []byte(`{"state":{"insights":"enabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusNotFound,
+			},
+		},
+		{
+			description: "unsatisfied dependency",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"disabled"}', FALSE);`),
+			input: request{
+				method: http.MethodPut,
+				url:    "/templates/rhc",
+				body:   []byte(`{"state":{"insights":"disabled","remediations":"enabled"}}`),
+				headers: map[string]string{
+					"X-Rh-Identity": base64.StdEncoding.EncodeToString([]byte(`{"identity":{"account_number":"10064","auth_type":"basic","employee_account_number":"10064","internal":{"org_id":"78606"},"org_id":"78606","type":"User","user":{"email":"collett@elfreda.name","first_name":"Maricela","is_active":true,"is_internal":false,"is_org_admin":true,"last_name":"Purdy","locale":"pa","user_id":"algae","username":"torque"}}}`)),
+				},
+			},
+			want: response{
+				code: http.StatusUnprocessableEntity,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			s := newTestServer(database)
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			req := httptest.NewRequest(test.input.method, test.input.url, bytes.NewReader(test.input.body))
+			for k, v := range test.input.headers {
+				req.Header.Add(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			router := chi.NewMux()
+			router.Use(identity.EnforceIdentity)
+			router.Put("/templates/{name}", s.updateTemplate)
+			router.ServeHTTP(rr, req)
+
+			got := response{code: rr.Code, etag: rr.Header().Get("ETag")}
+
+			if got.code != test.want.code {
+				t.Fatalf("%v != %v (%v)", got.code, test.want.code, rr.Body.String())
+			}
+
+			if test.want.body == nil {
+				if got.etag != test.want.etag {
+					t.Errorf("%v != %v", got.etag, test.want.etag)
+				}
+				return
+			}
+
+			got.body = map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got.body); err != nil {
+				t.Fatal(err)
+			}
+
+			ignore := cmpopts.IgnoreMapEntries(func(k string, v interface{}) bool {
+				return k == "created_at" || k == "updated_at"
+			})
+			opts := []cmp.Option{cmp.AllowUnexported(response{}), ignore}
+			if test.want.etag == "" {
+				opts = append(opts, cmpopts.IgnoreFields(response{}, "etag"))
+			}
+			if !cmp.Equal(got, test.want, opts...) {
+				t.Errorf("%v", cmp.Diff(got, test.want, opts...))
+			}
+		})
+	}
+}
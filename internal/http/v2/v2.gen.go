@@ -18,25 +18,80 @@ import (
 // Base64 encoded, gzipped, json marshaled Swagger object
 var swaggerSpec = []string{
 
-	"H4sIAAAAAAAC/9xY32/bNhD+Vw7cAL+okZcmL3pbi60L9qvIuqc0CM7SyWZHkQp59OoF/t8HkrJkx7Kb",
-	"tkkw7CmWePruePfdx2PuRGma1mjS7ERxJyy51mhH8eFsOg1/SqOZNIefTB85bxVKHZ5cuaAG4/tVS6IQ",
-	"jq3Uc7FerzNRkSutbFkaLQrxCiu4pFtPjsU6E2fTs8dC/s0w/Gi8rgLu+eNFfKGZrEYFf5BdkoUfrDVW",
-	"BLsEEjP01ppaKgo/W2tasixT6rAsjdd8I6vwtIt8SRX8hAydDWjfzMiK7H5MmcCS5ZLGEBrDBAvjGEqj",
-	"azn3FsMakMaZogocI9MAOTNGEeqAGeqtJOryMO4uZIDyDmpjwXqtpZ7D6x4DKmSE0ihFZQQZdWkJmaob",
-	"5H2X72RDYGpoUyYh2u4ADekYS2ZXAfBa3noCWZFmyStYovI0CqKdnC8S279s9xcdwoP2buz8KAmMnaOW",
-	"/yRnn47eUkOVjNZfsYPLAQVahauZMX+5kfDX/Ssz+0Alpz6RujaxhSQH6ovk7kWDGueRx0uyLgV0GlPQ",
-	"ksZWikK8PJmeTEUmWuRFDD8fvBd3Yk4jBHlttGPrS3aAugJL7K12gPC9dnKmqN8AOC85sB/Y9CkgwNQm",
-	"Yfu8ILBJhKjaMO5ExAhTsi4qUYg3xG87zBirxYaYrBPF1Z0IOiJuPdmVyITGJiSgQwp1DhW69dJSJQq2",
-	"nrIjknOd7crt6Z54YdsqWcbI8o8vVtioURHbLs5u8n7/OaltBP7WUi0K8U0+SH7eB5AHo0GZP2V7tqW2",
-	"x22DUVRN3zRoV5GlbCUtCVDvF/FgnSJI3j0cpssADi3OpQ7CA2gtrrZUxvVuUsfVMhglOT6BdwuCPy9/",
-	"gVhlGOoPEyUbyZPIw4mpa0c8gRI1zAi8oyoQb+O024Tzil2CrKhGrzj1dghmAycdnE8P2WzcSAfTcapu",
-	"MvIgqjpj+WYWXgws6pyGTu6FughZFZkg7RtRXG1L+LaeFxit7n93vadc62w8npiC8WjOpz2K1ExBWg7C",
-	"pCyJkW4bPv28dvvgzL2JYfeAj1wZ85N1expd6uIcXevIEhYlU+MOtVY3fuSb2WMQ6Ujz+GwY1WgStvXp",
-	"qrPLus1kfTX6dG5ius6eQmu+UD/eEAOCko5Dh6BSfVsH0Na4sVMkMjR2ronvUKkVxPkqvgdNfx8+EdLX",
-	"m4SnHJLjV6ZafQWF/ifT3TMPVM8+AW03TFeynTxvZeBedONdszsgrPdU6bvPotSDFGK/WROj453p5d5d",
-	"7Ek8hnvar6aKZ+0zCcWm6bebe3eMyO9ktX7ILOFaKmUty/6esjU4zFbxsJ/IagJhsh1GhqNjxkUdlyIy",
-	"qu7Ify9Kby1pfi/CkR+nig3IiIMsLjRBKSyVpHmIz4VROYZfgdSOCatj88OB8SG4G47ZJx1wH41p/8mh",
-	"Nx1a92mUwnfxPwwp694qUYgcW5nv3qvy5alYX6//DQAA///rNexysREAAA==",
+	"H4sIAAAAAAAC/+w9a2/ctpZ/hdAuoBareMaOcxeZfup10lvvJk3gpF1g7w0CWjozwxuJVEnKzmzg/744",
+	"fOnFmZHjiWtf9FMdiTo8PO8Xp1+SXFS14MC1ShZfkjXQAqT58+V7usL/FqByyWrNBE8WyUuumd4QTVdE",
+	"LIleA6mlWLISMlKAZFdQkKUUFWFakfMXSZaofA0VRUB6U0OySJSWjK+Sm5sseQ9VXVINU7fSbv1gL/OK",
+	"VUCYJtdUkZIqTZq6oBqKnRjcZElNJa1AuzOfL19Tna9vcWwCn2vINRREC3IJJG+kBK4zQhWRoBvJoSCM",
+	"m0/wmMRS+Ii8XwOR8HsDShOGa/9pwVwzvSanxyfkrYRc8IIhBuQnykoEtCSUC70GGfZnyu95lGQJQ2Tt",
+	"FkmWcFrhec+XT+yxpnHjFkTwDPlmp+1tgrx1bCWK8RzuduKbLJGgasEVGOafzuf4n1xwDVybL+CzntUl",
+	"xT2+7IbUp9RfaUEu7HGTmyw5nZ8eCvIvQpOfRMMLC/f5oeCeCb4sWW7RPT45FNgIW+0Ozw61w69cNXUt",
+	"JArFaygYJe/xE9zkZHgMWtclyyl+OfunEoOt/l3CMlkk/zZrTeLMvlWzF1ADL4Dnm5dSChlHpJYiB6Xo",
+	"ZQnE6gqi8exwYnXONUhOS/IO5BVI4nHxUm7EuEUV/1VLUYPUzIq4AnnFchir9i+0Aq/UqKdMoo651dkQ",
+	"syy5omUTAXPhPzXvPcAdcK7XwMdgfot8bf4uwtmI4SUoosUY7k14Ii7R0OBOQw6OaFMh61aRQ71rqorK",
+	"jcfnionSmKCADAKI0cgsZIIb8ExDpfaJ2W/+k6Q9ApWSbhJrrSx1k8XfA7a9bT5Ezv2zUPqi4ePz5hLw",
+	"GB+pHh/5PXrTrpdD01swVaNRtb4O366F0rGT4/OPrBjDRWQI41fAtZAbGyCMvhZyFf34AgryM9VEyBXl",
+	"7P/MmQkrwHolK5ERcO4IUZDnL4bu3IrV3hPKhkcBvi3p5lKITy2xJJENJ+cvMiIk4U1ZereGj3PRlAXh",
+	"QpvQwTIEvVhTlmhFkoWWDUS2V5rqRkVE1Tz3Z6IaXafGs+CxNt2DJlkCvKlQlFCKEW6WqCbPQaEwLykr",
+	"G2noySoQDRIhpzwHNOAfIhg5v7xbmizasRhtggI7QX7FlB4Lc0E1naxlDtJYx7KkZPzT3u9fmUU3WVKB",
+	"3us5XuOasfZqmvjdMot9THlfeXT6p10yqXRMQdAQXAH59eKVlwGzlNTWVIy4VtKpcErqwPxARMW0id3W",
+	"wPER41QzviKXG4xElZCxnTh8nrgTrjQ7ZTbc3cSVGq6mgcOVTDRqD8gBgyyFYyx57Xg+MKai4THJF5qW",
+	"hDfVJUhEyIgnqdAwIMV0GxW3GDGuYQXSSmPFIlBf08+saqoR3G4ETgc870AVy6WCCNhfBuDUJ1bXUJBL",
+	"WAppFdhlGttgD4hoieKPETaOUfUtkuRNDdJ6v7HES1GNMf6vd29+IW8F7i+9xVaikTmQUtg4D49TiSsg",
+	"lBckF/WGCL9L1GmLGrfxppEWaJwkIATzR11SE8i4BwgQoUBPWDpiSvV6GtqayhXogHZGlkIS+EyrugSS",
+	"ztBywoxxxVZrrdJbhGQhlqJFkRF3AkMNxLpLjSH7RJ24E0Q55vzIiFU0N3zf6cLdGifBsdPQHBU5BqES",
+	"2vplkgu+ZKvG4k+Ao8ssjJPpCOelECVQY+zROpcMvZiFW0vIjf9xbja6U38T58GQObLhHJX4LEAlaMdJ",
+	"LsoSclx9RF6EPTLSKOsAgTCuNNAijuO+qEwsQ6xi1uKrCP2iwYn7ruHs9wYmhE5e3g5JrnMH8xDEOnik",
+	"yHjOalqOIf6qQBIhQzLiBVivqSYVLZx5XFMed7QSqMs3h5jic7JiV8ANmfaBqTDFDUnFoZhy0cIltQth",
+	"1ddwRILSQkLxMW6wx/G2XjPVyzI8BFPa6/jrpZAVKkXSNKyI0cYa/ojUU6ljuaSlstnTMVCKZrX+gaS0",
+	"qBhPSUXlJ+WWuTUFk5DrcuNrXCjDl1R1o2laM1OVcjnOk1xw1VTGyLmjJVlidoh6DGu99sSU78yiaJTs",
+	"dPwFWy5jpjluVM8sKXzaYFaRJYOyMAxg2lEB6R73y2NJ0CL2PIYyXVEUqSnSwkz1EClCUUT8lxOkw7Ex",
+	"kjJZkVDkei0UWOOAue5yCTIjyhaWLjdBdEyFMZuWaDjYlryxdGN3ThrO2eZse865QyIOkDc5SI8gb3rX",
+	"1rkG54UlbUo9seRkMhwapK8QoEyyrkATFq0L9GpC8U0UsQV85QWvapQma4oqJySh3doZU53i2SQedap/",
+	"ETb10BkVZ5qKciKBFqaC2Xk5oZBnC+9blMsojXEhBaGKUPIJTDktkDZVw7BtENduJ2aXXzTPodaqS6sR",
+	"uFFVbZvwOK2dmIpE5cd5idTZqbSjyGPDv600+65veMYHErfDJmJVJliRd94v0cJW82n5tkeWiCoMK1MG",
+	"I6D52qOUoSCMzesReQdA/vbyPZkFJfGxUXhgMph1MNh6DRvH/6Mkgr9vbn1lHbTXg2oLdZFDb7Ev/7MG",
+	"o/U9YAqgsBLcjVRT5as2QwZ13Gtc3/wpvcLZQB+bbIyP9rmH2uttopmJNcQeJ25fRfQUOoA79KAegT9s",
+	"+wqxmLCh5ced1YNYV4isqYqnKHbdV0AMjnAHXHX33tWkJlgbAgjV6zsxFTpAX1OF2elGxwJ7Y7LwpY2l",
+	"mS7xnc3mnlSU05XJK65AKrvNiS1hAac1SxbJ06P50dwVcQzhZlg3UbMvrLiZtT2EFURLs1oyuLKsqoTS",
+	"REIOXI+7Cm2A1GmaOOOwZNa8GzfIipQgKiQMXWTkes3yNRLVf5iqXoMIjXmoUZ0XyQKxxQK+bXUk/QmO",
+	"v09pOJmJAcSjnRdgtsznFcum0m1jdl/U/WEwSXAyavl+fec5NCvG7eA3/22HAObbYASkZrioHUTYt/a0",
+	"07fevRYXIWLK9kiTRfI30C7MiNQcTMyHXDYfzUKpYZoU/sgVw8jUf2arL6ER3M0Tx8LXtgFT8nsDctNK",
+	"oRFlg9YRuWh4rNMp5CpVZokitWBc2xdMEeCFeRAVVN8O3CemvjLXyqdBsRXQFvtvLKhmNuGKF0cbWpW3",
+	"HE940PIYhKabdzgxtP+YIIXU97ugICVTulONbUPUjvB1wyVTfJeg8KXr/ayZMmapW9O1dYoj8taDpRI6",
+	"ZQhf8zUDbxnhcA1K23gR470SlNWEFD/5eLkZC7vJKXVmGyKUY+d5yUoNMrpBaqtBqVmehgbEETm3viy1",
+	"Lb/oNu60mVloyMVUh4ChX+grigubHGBziZiQxmufaQkKbiNZQjkRNcXA1n5uj5La7pJDNJw+p9y11zH7",
+	"jCupZ/8eJW37Y4HlWpgumW+RKU2lZa7wlW0XlaimNGWDLeptce9Nq4VMYp4lFePY8DN/j3tu+9uDXXxt",
+	"k3ALHr5TF0HjGeJhISeL43kXq+MpWJ2JqqJPFCCJkfumvGgpKKQml5vMcr9lsc0yXc0VJdJaN22LCKkB",
+	"sAhvU6zWSOgsZ4qkVOUp+c6ODpmDfE+EJCmilpLvOj22IOkLfJe1SeECQXxvJxgRU1MbcchTaaOajKTt",
+	"B2mrNBlJQ08hCGYjc0iPtjDAye3uSc0had/wcuP42rLaIUTo0ng4dFVWo3tUpJxc/HRGnj59+ty8VppW",
+	"9ZAwJ/OT0yfz4yfzk/fzp4v56WL+7H/T77ecIBAC9z3gOUIX+r4PYjc+wEmMZBv8g1G1pb7vUvTjqZHM",
+	"JS0VbMXJfncoXEIrzrdOHSJGRwqm/MPdOIUm4R6saFmK65dVrTe/2Rwp1rB60zXsofqPDiGYroxo+gl4",
+	"O/qdontIjceIDn0ckR85wZQl+BsLSA0GZII3bT06vtumqmHWZfupv2Ve0C3rHyQWu0N8RUfBEAKsRayp",
+	"c2bUyhhDb+Ixh0TBNs+RCZ3uINV+ZkH1JlAEN2VCX0JnSqHfNTKRmqpTagMncJE6MOldgNU6E8EMh+kv",
+	"IadVu8n12iLRzq5j0cmN+WJTVN9hrN3PqLsZ+V5cZrC6Zgq6h6dBMn8gLLbf/DnxY9y4Se9oinwCwEAl",
+	"FxVSqnNnoB8QWbP3NpQeByFRTDzaJTN/d8CKviHMX0WxuZXUT+tZ/qsPgjz02Ys9Ew39WYaMoB7Iwouq",
+	"Deqvd/VDHvyowy079d2yrZPpD9FyXz+7vxm5kONDu5DodZDQ4ojcCIvBdMtmZo0B+HR+eh+Y4oWY16Iw",
+	"+fZd0L1d2eL5lLXPO5dp9qw9PuncWNmz9uTkDu7au9+e+vWqIDPnGqbV5MJEqP3aB2BbaiAmFOs+MOZA",
+	"NLpTRGbKjUMJDu1dQu+7ffvHJmTIPuKPGxyp31v17yeiFUDVZjzqf8XSu3LnbK0n9N+raO3gzB6/dZff",
+	"Ot7bEuvdQfDvWuftC4Cbeo1dH/zRdQvM+OtrkCsgZuyXfIeZ238+ff4Xk3iY150Xf3k+P/meFCJvKvB1",
+	"17HcmWpWRLbbNMEWYazcGAxR0jrXPWi7R/BRIVEzCX/oOZv4ATSEUFMsY0h1AlQ7QlyMA1QJjz5E1TGC",
+	"mpEHe67bxq0tPC5IKfgKZCjyC2k33hfWkh+JjAUipKIbLAYi0S83OBONX1GS2tWe0U7IvECMVd/gd79B",
+	"8hOz53+Mrca02a3+gH1sEKa7YYXquXXH+AyIKRNk9xC+f+vQU+2bddl7P2vLiKEWAaktgy8/2ititi5k",
+	"bIMiNKzRoucLrZEYT7vcfFVc+Qhc1Z8h5e1DyuNnU9Y+u6fw81czqxMPHHpBKI4oTOnHqRpytmT5rtbv",
+	"eO5gX6/ORgkDDK3nsjs7Y2Jm1IaBc6d3dwnov1xHyDqu7jbKhQDu+jq106VLvN7/QOLbrS7u9kMUf0Bx",
+	"9PAW6AE2t8c6EFGlWeEuBEzI6NyFh0vQ1wB831xFmG0dNoB9sHwrxQx9ZXMm6j3hPxKnW/9IUAvNILFX",
+	"4ehY0XBoqaPCfv7VbNWiz8Jod9ZHe3zfYHCBxcS3kAOGGEzvUiNzK2PiKEj0kpa5RN4lj9WmLn2S7AC6",
+	"mU24uCM8XTxZfvCBSejbt22YYEaiXa1wjeNhjFx1ufVYxlzOHC/0teg0YcZ2wIwwfd2gS+cnBVT0NwUm",
+	"+t7OlKDaUy/qD7jsUq2fzbnuolvfZDIw2z5EYlIf2fBHM0XSQ/iexkjuYbLycB3Ue5xms8pDezcn21pW",
+	"TPH95cPFlz2NWZMdD0PfkDq76xbDe3nThn0xJLBWg7WFPMG5LQZNMQg2LO7W92x2r4bXBCNXSa/Xon3E",
+	"dAhQwqSR7FzG/bM9HG8POwJuzQsegMG9hxb1LQpg37ZYFSv1/NkyfJD1nem+4RG3Fy+seSB0HPsbn+Sv",
+	"701LRdvLfu18NOWhXgxZ1yV1Lxb6m6DBxnfv5YbM1oOPxpW+aHvXnt5tLopHyvJbwpI7hg+eTDnVtBTW",
+	"jsx8a/UO6UFIDj2ovfF9O9luCuAxTrwPeE0e0G73fySxdQ/hf4HYunfN8sGNJ7bk3j+naOSyGH1pq0eO",
+	"9GmIzno3VHuDi4MbvsE8DgcbjMmadjF42/CeJ35yqBm8R3aruaKfXwFf6XWyOHn2zGiB//fx3X9ypTvI",
+	"5e7kWwh/9DhXex/5gMFZ7ye6v21X648ZfgpyO3CCsy/I3BsrjSXoiFy+MM+jjq8N3+0sk+3uhr4Qqkjv",
+	"18uD8kswZWi6XJrUbaziFpmOiu90iT3ViSdc7s1dGjenkbvUgpw5ob6fyohjBo3wNZsQak5i4K7o5GFw",
+	"Yn4v1uRremgxQ3Jf/THGVyVEBaNuooJh/Hb4yVrrk72jXpbj/wnA7aTG/mDFHyk4+6skw/8ZwOEG+u8t",
+	"mLiDX7+LQ39cKvhnBWNUwbDKH3MkN+7XQ7yiNrJMFsmM1mzW/1GO2dVJcvPh5v8HABHCmTBeZQAA",
 }
 
 // GetSwagger returns the content of the embedded swagger specification file
@@ -1,6 +1,8 @@
 package instrumentation
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog/log"
@@ -14,6 +16,17 @@ const (
 	labelGetProfiles        = "get_profiles"
 	labelGetProfile         = "get_profile"
 	labelCreateProfile      = "create_profile"
+	labelPatchProfile       = "patch_profile"
+	labelRestoreProfile     = "restore_profile"
+	labelGetHostStatus      = "get_host_status"
+	labelGetProfileHosts    = "get_profile_hosts"
+	labelGetProfileDiff     = "get_profile_diff"
+	labelGetTemplates       = "get_templates"
+	labelGetTemplate        = "get_template"
+	labelCreateTemplate     = "create_template"
+	labelUpdateTemplate     = "update_template"
+	labelDeleteTemplate     = "delete_template"
+	labelPruneProfiles      = "prune_profiles"
 	labelPassed             = "ok"
 	labelFailed             = "failed"
 	labelError              = "error"
@@ -64,6 +77,46 @@ var (
 		Name: "config_manager_rbac_requests_total",
 		Help: "The total number of RBAC requests",
 	}, []string{"status"})
+
+	consumerQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "config_manager_consumer_queue_depth",
+		Help: "The number of kafka messages waiting for a worker",
+	}, []string{"consumer"})
+
+	consumerHandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "config_manager_consumer_handler_duration_seconds",
+		Help: "The time taken to handle a kafka message",
+	}, []string{"consumer"})
+
+	inventoryUnknownEventTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "config_manager_inventory_unknown_events_total",
+		Help: "The total number of inventory events of an unknown type",
+	})
+
+	inventoryHostDeletedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "config_manager_inventory_hosts_deleted_total",
+		Help: "The total number of hosts deleted from inventory whose runs were tombstoned",
+	})
+
+	runsCanceledTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "config_manager_runs_canceled_total",
+		Help: "The total number of pending runs canceled through playbook dispatcher",
+	})
+
+	profilesPrunedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "config_manager_profiles_pruned_total",
+		Help: "The total number of profiles deleted by the prune module",
+	})
+
+	pruneReferencedProfiles = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "config_manager_prune_referenced_profiles",
+		Help: "The number of profiles outside the retention policy that host runs refer to, as of the last prune run",
+	})
+
+	pruneDryRunProfiles = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "config_manager_prune_dry_run_profiles",
+		Help: "The number of profiles outside the retention policy found by the last dry run of the prune module",
+	})
 )
 
 func GetAccountStateError() {
@@ -90,6 +143,50 @@ func CreateProfileError() {
 	internalErrorTotal.WithLabelValues(labelDb, labelCreateProfile).Inc()
 }
 
+func PatchProfileError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelPatchProfile).Inc()
+}
+
+func RestoreProfileError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelRestoreProfile).Inc()
+}
+
+func GetHostStatusError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelGetHostStatus).Inc()
+}
+
+func GetProfileHostsError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelGetProfileHosts).Inc()
+}
+
+func GetProfileDiffError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelGetProfileDiff).Inc()
+}
+
+func GetTemplatesError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelGetTemplates).Inc()
+}
+
+func GetTemplateError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelGetTemplate).Inc()
+}
+
+func CreateTemplateError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelCreateTemplate).Inc()
+}
+
+func UpdateTemplateError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelUpdateTemplate).Inc()
+}
+
+func DeleteTemplateError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelDeleteTemplate).Inc()
+}
+
+func PruneProfilesError() {
+	internalErrorTotal.WithLabelValues(labelDb, labelPruneProfiles).Inc()
+}
+
 func GetPlaybookError() {
 	playbookRequestErrorTotal.Inc()
 }
@@ -143,6 +240,42 @@ func WorkspaceLookupError(err error, org string) {
 	log.Error().Err(err).Str("org_id", org).Msg("Error doing workspace id lookup")
 }
 
+func ConsumerMessageQueued(consumer string) {
+	consumerQueueDepth.WithLabelValues(consumer).Inc()
+}
+
+func ConsumerMessageDequeued(consumer string) {
+	consumerQueueDepth.WithLabelValues(consumer).Dec()
+}
+
+func ConsumerMessageHandled(consumer string, d time.Duration) {
+	consumerHandlerDuration.WithLabelValues(consumer).Observe(d.Seconds())
+}
+
+func InventoryUnknownEvent() {
+	inventoryUnknownEventTotal.Inc()
+}
+
+func InventoryHostDeleted() {
+	inventoryHostDeletedTotal.Inc()
+}
+
+func RunsCanceled(count int) {
+	runsCanceledTotal.Add(float64(count))
+}
+
+func ProfilesPruned(count int) {
+	profilesPrunedTotal.Add(float64(count))
+}
+
+func ProfilesPruneReferenced(count int) {
+	pruneReferencedProfiles.Set(float64(count))
+}
+
+func ProfilesPruneDryRun(count int) {
+	pruneDryRunProfiles.Set(float64(count))
+}
+
 func Start() {
 	internalErrorTotal.WithLabelValues(labelDb, labelGetAccountState)
 	internalErrorTotal.WithLabelValues(labelDb, labelUpdateAccountState)
@@ -150,6 +150,10 @@ func (w *BatchWriter) sendBatch(batch []*cloudwatchlogs.InputLogEvent) {
 
 // Flush immediately writes any pending events to the CloudWatch API.
 func (w *BatchWriter) Flush() error {
+	// An unbuffered writer has nothing pending.
+	if w.ch == nil {
+		return nil
+	}
 	w.flushWG.Add(1)
 	w.ch <- nil
 	w.flushWG.Wait()
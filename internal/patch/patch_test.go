@@ -0,0 +1,292 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			doc, patch string
+		}
+		want      string
+		wantError bool
+	}{
+		{
+			description: "replace member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"a":"b"}`,
+				patch: `{"a":"c"}`,
+			},
+			want: `{"a":"c"}`,
+		},
+		{
+			description: "remove member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"a":"b","b":"c"}`,
+				patch: `{"a":null}`,
+			},
+			want: `{"b":"c"}`,
+		},
+		{
+			description: "nested members",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"active":true,"state":{"insights":"enabled","remediations":"enabled"}}`,
+				patch: `{"state":{"remediations":"disabled"}}`,
+			},
+			want: `{"active":true,"state":{"insights":"enabled","remediations":"disabled"}}`,
+		},
+		{
+			description: "replace array",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"a":["b"]}`,
+				patch: `{"a":["c","d"]}`,
+			},
+			want: `{"a":["c","d"]}`,
+		},
+		{
+			description: "non-object patch",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"a":"b"}`,
+				patch: `["c"]`,
+			},
+			want: `["c"]`,
+		},
+		{
+			description: "malformed patch",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"a":"b"}`,
+				patch: `{"a":`,
+			},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := MergePatch([]byte(test.input.doc), []byte(test.input.patch))
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSONEqual(t, got, test.want)
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		description string
+		input       struct {
+			doc, patch string
+		}
+		want      string
+		wantError bool
+	}{
+		{
+			description: "add member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":"bar"}`,
+				patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			},
+			want: `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			description: "add array element",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":["bar","baz"]}`,
+				patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			},
+			want: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			description: "append array element",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":["bar"]}`,
+				patch: `[{"op":"add","path":"/foo/-","value":"qux"}]`,
+			},
+			want: `{"foo":["bar","qux"]}`,
+		},
+		{
+			description: "remove array element",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":["bar","qux","baz"]}`,
+				patch: `[{"op":"remove","path":"/foo/1"}]`,
+			},
+			want: `{"foo":["bar","baz"]}`,
+		},
+		{
+			description: "replace nested member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"active":true,"state":{"insights":"enabled"}}`,
+				patch: `[{"op":"replace","path":"/state/insights","value":"disabled"}]`,
+			},
+			want: `{"active":true,"state":{"insights":"disabled"}}`,
+		},
+		{
+			description: "move member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+				patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			},
+			want: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			description: "copy member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":{"bar":"baz"}}`,
+				patch: `[{"op":"copy","from":"/foo","path":"/qux"}]`,
+			},
+			want: `{"foo":{"bar":"baz"},"qux":{"bar":"baz"}}`,
+		},
+		{
+			description: "escaped pointer",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"a/b":1,"m~n":2}`,
+				patch: `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`,
+			},
+			want: `{"a/b":3}`,
+		},
+		{
+			description: "successful test",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"active":true}`,
+				patch: `[{"op":"test","path":"/active","value":true},{"op":"replace","path":"/active","value":false}]`,
+			},
+			want: `{"active":false}`,
+		},
+		{
+			description: "failed test",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"active":true}`,
+				patch: `[{"op":"test","path":"/active","value":false},{"op":"replace","path":"/active","value":false}]`,
+			},
+			wantError: true,
+		},
+		{
+			description: "remove missing member",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":"bar"}`,
+				patch: `[{"op":"remove","path":"/baz"}]`,
+			},
+			wantError: true,
+		},
+		{
+			description: "add to missing parent",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":"bar"}`,
+				patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			},
+			wantError: true,
+		},
+		{
+			description: "array index out of bounds",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":["bar"]}`,
+				patch: `[{"op":"add","path":"/foo/2","value":"qux"}]`,
+			},
+			wantError: true,
+		},
+		{
+			description: "missing value",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":"bar"}`,
+				patch: `[{"op":"replace","path":"/foo"}]`,
+			},
+			wantError: true,
+		},
+		{
+			description: "unknown operation",
+			input: struct {
+				doc, patch string
+			}{
+				doc:   `{"foo":"bar"}`,
+				patch: `[{"op":"merge","path":"/foo","value":"baz"}]`,
+			},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := JSONPatch([]byte(test.input.doc), []byte(test.input.patch))
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSONEqual(t, got, test.want)
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(g, w) {
+		t.Errorf("%v", cmp.Diff(g, w))
+	}
+}
@@ -0,0 +1,60 @@
+// Package playbook generates the Ansible playbooks that apply a profile's state
+// to a host.
+package playbook
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+)
+
+//go:embed playbooks/*.yml
+var embedded embed.FS
+
+// Sources returns the playbooks of the services. They are read from dir if it
+// is not empty, and from the playbooks embedded in the binary otherwise.
+func Sources(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	sources, err := fs.Sub(embedded, "playbooks")
+	if err != nil {
+		panic(err)
+	}
+	return sources
+}
+
+// Generate returns a playbook that applies state to a host. It is the
+// concatenation, in order of service name, of the playbook of each service read
+// from sources: "<service>_setup.yml" if the service is enabled and
+// "<service>_remove.yml" otherwise.
+func Generate(sources fs.FS, state map[string]string) (string, error) {
+	var playbook bytes.Buffer
+	for _, service := range slices.Sorted(maps.Keys(state)) {
+		name := service + "_remove.yml"
+		if state[service] == "enabled" {
+			name = service + "_setup.yml"
+		}
+
+		data, err := fs.ReadFile(sources, name)
+		if err != nil {
+			return "", fmt.Errorf("cannot read playbook: %w", err)
+		}
+
+		// Each playbook is a YAML document listing plays; only the first
+		// document start marker is kept so the plays form a single list.
+		if playbook.Len() > 0 {
+			data = bytes.TrimPrefix(data, []byte("---\n"))
+		}
+		playbook.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			playbook.WriteByte('\n')
+		}
+	}
+
+	return playbook.String(), nil
+}
@@ -0,0 +1,89 @@
+package playbook
+
+import (
+	"config-manager/internal/catalog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("..", "testdata")
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		description string
+		input       map[string]string
+		want        string
+		wantError   bool
+	}{
+		{
+			description: "single service",
+			input:       map[string]string{"test1": "enabled"},
+			want:        read("test1_setup.yml"),
+		},
+		{
+			description: "services in name order",
+			input:       map[string]string{"test2": "enabled", "test1": "disabled"},
+			want:        read("test1_remove.yml") + read("test2_setup.yml")[len("---\n"):],
+		},
+		{
+			description: "missing playbook",
+			input:       map[string]string{"test3": "enabled"},
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := Generate(Sources(dir), test.input)
+
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestGenerateEmbedded(t *testing.T) {
+	for _, service := range catalog.Services() {
+		for _, value := range service.Values {
+			t.Run(service.Name+" "+value, func(t *testing.T) {
+				got, err := Generate(Sources(""), map[string]string{service.Name: value})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(got, "---\n- name: ") {
+					t.Errorf("not a list of plays: %q", got)
+				}
+			})
+		}
+	}
+
+	got, err := Generate(Sources(""), catalog.Complete(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(got, "---\n"); n != 1 {
+		t.Errorf("%v document start markers in %q", n, got)
+	}
+}
@@ -0,0 +1,193 @@
+package reconcile
+
+import (
+	"config-manager/infrastructure/persistence/dispatcher"
+	"config-manager/internal"
+	"config-manager/internal/config"
+	"config-manager/internal/db"
+	"config-manager/internal/instrumentation"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// LabelService is the playbook-dispatcher run label identifying runs
+	// created by config-manager.
+	LabelService = "service"
+
+	// LabelProfileID is the playbook-dispatcher run label carrying the ID of
+	// the profile applied by the run.
+	LabelProfileID = "profile_id"
+
+	// ServiceName is the value of the LabelService label.
+	ServiceName = "config_manager"
+
+	runName = "Apply Host Configuration"
+
+	// dispatchBatchSize is the maximum number of runs sent to
+	// playbook-dispatcher in a single request.
+	dispatchBatchSize = 50
+)
+
+// HostLister enumerates the rhc-connected hosts of the org identified in the
+// context. It is implemented by *inventory.InventoryClient.
+type HostLister interface {
+	GetAllInventoryClients(ctx context.Context) ([]internal.Host, error)
+}
+
+// HostRunRecorder records the host runs created by dispatching profiles. It is
+// implemented by *db.SQLHostRunRepository.
+type HostRunRecorder interface {
+	InsertHostRun(ctx context.Context, run db.HostRun) error
+}
+
+// Run records the outcome of dispatching a profile to a single host.
+type Run struct {
+	HostID    string     `json:"host_id"`
+	ClientID  string     `json:"rhc_client_id"`
+	ProfileID uuid.UUID  `json:"profile_id"`
+	RunID     *uuid.UUID `json:"run_id,omitempty"`
+	Code      int        `json:"code"`
+}
+
+// Reconciler applies the state of a profile to hosts by dispatching the
+// rhc-worker-playbook configuration run to each of them through
+// playbook-dispatcher.
+type Reconciler struct {
+	hosts      HostLister
+	dispatcher dispatcher.DispatcherClient
+	runs       HostRunRecorder
+}
+
+// NewReconciler creates a Reconciler that enumerates hosts using hosts and
+// creates runs using dispatcher. Each dispatched run is recorded using runs.
+func NewReconciler(hosts HostLister, dispatcher dispatcher.DispatcherClient, runs HostRunRecorder) *Reconciler {
+	return &Reconciler{
+		hosts:      hosts,
+		dispatcher: dispatcher,
+		runs:       runs,
+	}
+}
+
+// ApplyProfile dispatches profile to every rhc-connected host of the org
+// identified by the X-Rh-Identity header stored in ctx.
+func (r *Reconciler) ApplyProfile(ctx context.Context, profile db.Profile, principal string) ([]Run, error) {
+	hosts, err := r.hosts.GetAllInventoryClients(ctx)
+	if err != nil {
+		instrumentation.InventoryRequestError()
+		return nil, fmt.Errorf("cannot get hosts from inventory: %w", err)
+	}
+
+	return r.ApplyProfileToHosts(ctx, profile, hosts, principal)
+}
+
+// ApplyProfileToHosts dispatches profile to each of hosts and returns a Run for
+// every run playbook-dispatcher was asked to create. Hosts without a valid
+// rhc_client_id are skipped. Nothing is dispatched if profile is not active.
+func (r *Reconciler) ApplyProfileToHosts(ctx context.Context, profile db.Profile, hosts []internal.Host, principal string) ([]Run, error) {
+	orgID := db.JSONNullStringSafeValue(profile.OrgID)
+	logger := log.With().Str("profile_id", profile.ID.String()).Str("org_id", orgID).Logger()
+
+	if !profile.Active {
+		logger.Debug().Msg("profile is not active, skipping dispatch")
+		return nil, nil
+	}
+
+	playbookURL := PlaybookURL(profile.ID)
+
+	runs := make([]Run, 0, len(hosts))
+	inputs := make([]dispatcher.RunInputV2, 0, len(hosts))
+	for _, host := range hosts {
+		recipient, err := uuid.Parse(host.SystemProfile.RHCID)
+		if err != nil {
+			logger.Warn().Err(err).Str("host_id", host.ID).Msg("skipping host with invalid rhc_client_id")
+			continue
+		}
+
+		inventoryID, err := uuid.Parse(host.ID)
+		if err != nil {
+			logger.Warn().Err(err).Str("host_id", host.ID).Msg("skipping host with invalid ID")
+			continue
+		}
+
+		runs = append(runs, Run{
+			HostID:    host.ID,
+			ClientID:  host.SystemProfile.RHCID,
+			ProfileID: profile.ID,
+		})
+		inputs = append(inputs, dispatcher.RunInputV2{
+			Recipient: recipient,
+			OrgId:     orgID,
+			Principal: principal,
+			Url:       playbookURL,
+			Name:      runName,
+			Labels: &dispatcher.Labels{
+				LabelService:   ServiceName,
+				LabelProfileID: profile.ID.String(),
+			},
+			Hosts: &dispatcher.RunInputHosts{
+				{InventoryId: &inventoryID},
+			},
+		})
+	}
+
+	var failed int
+	for start := 0; start < len(inputs); start += dispatchBatchSize {
+		end := min(start+dispatchBatchSize, len(inputs))
+
+		created, err := r.dispatcher.Dispatch(ctx, inputs[start:end])
+		if err != nil {
+			instrumentation.PlaybookDispatcherRequestError()
+			logger.Error().Err(err).Int("runs", end-start).Msg("cannot dispatch runs")
+			failed += end - start
+			continue
+		}
+
+		for i, c := range created {
+			if start+i >= end {
+				break
+			}
+			runs[start+i].RunID = c.Id
+			runs[start+i].Code = c.Code
+		}
+	}
+
+	for _, run := range runs {
+		logger.Info().Str("host_id", run.HostID).Str("rhc_client_id", run.ClientID).Interface("run_id", run.RunID).Int("code", run.Code).Msg("dispatched profile to host")
+
+		hostRun := db.HostRun{
+			HostID:    uuid.MustParse(run.HostID),
+			OrgID:     orgID,
+			ProfileID: run.ProfileID,
+			Status:    db.HostRunStatusFailure,
+		}
+		if run.RunID != nil {
+			hostRun.RunID = uuid.NullUUID{UUID: *run.RunID, Valid: true}
+			hostRun.Status = db.HostRunStatusPending
+		}
+		if err := r.runs.InsertHostRun(ctx, hostRun); err != nil {
+			logger.Error().Err(err).Str("host_id", run.HostID).Msg("cannot record host run")
+		}
+	}
+
+	if failed > 0 {
+		return runs, fmt.Errorf("cannot dispatch %v of %v runs", failed, len(inputs))
+	}
+
+	return runs, nil
+}
+
+// PlaybookURL returns the URL from which a host fetches the configuration
+// playbook for the given profile.
+func PlaybookURL(profileID uuid.UUID) string {
+	u := *config.DefaultConfig.PlaybookHost.Value
+	u.Path = path.Join(u.Path, config.DefaultConfig.URLBasePath("v2"), "playbooks")
+	u.RawQuery = url.Values{"profile_id": []string{profileID.String()}}.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,251 @@
+package reconcile
+
+import (
+	"config-manager/infrastructure/persistence/dispatcher"
+	"config-manager/internal"
+	"config-manager/internal/config"
+	"config-manager/internal/db"
+	"config-manager/internal/url"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+type fakeHostLister struct {
+	hosts []internal.Host
+	err   error
+}
+
+func (f *fakeHostLister) GetAllInventoryClients(ctx context.Context) ([]internal.Host, error) {
+	return f.hosts, f.err
+}
+
+type fakeDispatcher struct {
+	inputs [][]dispatcher.RunInputV2
+	err    error
+}
+
+func (f *fakeDispatcher) Dispatch(ctx context.Context, inputs []dispatcher.RunInputV2) ([]dispatcher.RunCreated, error) {
+	f.inputs = append(f.inputs, inputs)
+	if f.err != nil {
+		return nil, f.err
+	}
+	created := make([]dispatcher.RunCreated, 0, len(inputs))
+	for _, input := range inputs {
+		id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(input.Recipient.String()))
+		created = append(created, dispatcher.RunCreated{Code: 201, Id: &id})
+	}
+	return created, nil
+}
+
+func (f *fakeDispatcher) Cancel(ctx context.Context, inputs []dispatcher.CancelInputV2) ([]dispatcher.RunCanceled, error) {
+	return nil, nil
+}
+
+// fakeRecorder records host runs in memory.
+type fakeRecorder struct {
+	recorded *[]db.HostRun
+}
+
+func (f *fakeRecorder) InsertHostRun(ctx context.Context, run db.HostRun) error {
+	*f.recorded = append(*f.recorded, run)
+	return nil
+}
+
+// newTestReconciler creates a Reconciler that records host runs in memory.
+func newTestReconciler(hosts HostLister, d dispatcher.DispatcherClient, recorded *[]db.HostRun) *Reconciler {
+	return NewReconciler(hosts, d, &fakeRecorder{recorded: recorded})
+}
+
+func newHost(id, clientID string) internal.Host {
+	host := internal.Host{ID: id, OrgID: "2"}
+	host.SystemProfile.RHCID = clientID
+	return host
+}
+
+func TestApplyProfile(t *testing.T) {
+	config.DefaultConfig.PlaybookHost.Value = url.MustParse("https://console.redhat.com")
+
+	profile := db.Profile{
+		ID:     uuid.MustParse("e417581a-d649-4cdc-9506-6eb7fdbfd66d"),
+		OrgID:  &db.JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+		Active: true,
+	}
+	inactive := profile
+	inactive.Active = false
+
+	runID := func(clientID string) *uuid.UUID {
+		id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(clientID))
+		return &id
+	}
+
+	tests := []struct {
+		description string
+		profile     db.Profile
+		hosts       *fakeHostLister
+		dispatcher  *fakeDispatcher
+		want        []Run
+		wantInputs  int
+		wantError   bool
+	}{
+		{
+			description: "two connected hosts",
+			profile:     profile,
+			hosts: &fakeHostLister{
+				hosts: []internal.Host{
+					newHost("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60", "276c4685-fdfb-4172-930f-4148b8340c2e"),
+					newHost("0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f", "9a76b28b-0e09-41c8-bf01-79d1bef72646"),
+				},
+			},
+			dispatcher: &fakeDispatcher{},
+			want: []Run{
+				{
+					HostID:    "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
+					ClientID:  "276c4685-fdfb-4172-930f-4148b8340c2e",
+					ProfileID: profile.ID,
+					RunID:     runID("276c4685-fdfb-4172-930f-4148b8340c2e"),
+					Code:      201,
+				},
+				{
+					HostID:    "0f9e8d7c-6b5a-4c3d-8e1f-2a3b4c5d6e7f",
+					ClientID:  "9a76b28b-0e09-41c8-bf01-79d1bef72646",
+					ProfileID: profile.ID,
+					RunID:     runID("9a76b28b-0e09-41c8-bf01-79d1bef72646"),
+					Code:      201,
+				},
+			},
+			wantInputs: 2,
+		},
+		{
+			description: "host with invalid client ID",
+			profile:     profile,
+			hosts: &fakeHostLister{
+				hosts: []internal.Host{
+					newHost("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60", "not-a-uuid"),
+				},
+			},
+			dispatcher: &fakeDispatcher{},
+			want:       []Run{},
+			wantInputs: 0,
+		},
+		{
+			description: "inactive profile",
+			profile:     inactive,
+			hosts: &fakeHostLister{
+				hosts: []internal.Host{
+					newHost("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60", "276c4685-fdfb-4172-930f-4148b8340c2e"),
+				},
+			},
+			dispatcher: &fakeDispatcher{},
+			want:       nil,
+			wantInputs: 0,
+		},
+		{
+			description: "inventory error",
+			profile:     profile,
+			hosts:       &fakeHostLister{err: errors.New("unavailable")},
+			dispatcher:  &fakeDispatcher{},
+			wantError:   true,
+		},
+		{
+			description: "dispatcher error",
+			profile:     profile,
+			hosts: &fakeHostLister{
+				hosts: []internal.Host{
+					newHost("8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60", "276c4685-fdfb-4172-930f-4148b8340c2e"),
+				},
+			},
+			dispatcher: &fakeDispatcher{err: errors.New("unavailable")},
+			want: []Run{
+				{
+					HostID:    "8a1c3f2e-4b5d-4c6e-9f7a-1b2c3d4e5f60",
+					ClientID:  "276c4685-fdfb-4172-930f-4148b8340c2e",
+					ProfileID: profile.ID,
+				},
+			},
+			wantInputs: 1,
+			wantError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var recorded []db.HostRun
+			got, err := newTestReconciler(test.hosts, test.dispatcher, &recorded).ApplyProfile(context.Background(), test.profile, "test_user")
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+
+			var inputs int
+			for _, batch := range test.dispatcher.inputs {
+				inputs += len(batch)
+				for _, input := range batch {
+					if (*input.Labels)[LabelProfileID] != test.profile.ID.String() {
+						t.Errorf("missing profile label: %v", input.Labels)
+					}
+					if input.Url != "https://console.redhat.com/api/config-manager/v2/playbooks?profile_id="+test.profile.ID.String() {
+						t.Errorf("unexpected playbook URL: %v", input.Url)
+					}
+				}
+			}
+			if inputs != test.wantInputs {
+				t.Errorf("%v != %v", inputs, test.wantInputs)
+			}
+
+			if len(recorded) != len(test.want) {
+				t.Fatalf("recorded %v host runs, want %v", len(recorded), len(test.want))
+			}
+			for i, run := range recorded {
+				wantStatus := db.HostRunStatusFailure
+				if test.want[i].RunID != nil {
+					wantStatus = db.HostRunStatusPending
+				}
+				if run.Status != wantStatus || run.HostID.String() != test.want[i].HostID || run.ProfileID != test.profile.ID {
+					t.Errorf("unexpected host run: %#v", run)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyProfileToHostsBatches(t *testing.T) {
+	profile := db.Profile{
+		ID:     uuid.New(),
+		OrgID:  &db.JSONNullString{NullString: sql.NullString{Valid: true, String: "2"}},
+		Active: true,
+	}
+
+	hosts := make([]internal.Host, 0, dispatchBatchSize+1)
+	for i := 0; i < dispatchBatchSize+1; i++ {
+		hosts = append(hosts, newHost(uuid.NewString(), uuid.NewString()))
+	}
+
+	d := &fakeDispatcher{}
+	var recorded []db.HostRun
+	runs, err := newTestReconciler(&fakeHostLister{}, d, &recorded).ApplyProfileToHosts(context.Background(), profile, hosts, "test_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.inputs) != 2 || len(d.inputs[0]) != dispatchBatchSize || len(d.inputs[1]) != 1 {
+		t.Errorf("unexpected batches: %v", len(d.inputs))
+	}
+
+	for i, run := range runs {
+		if run.RunID == nil || *run.RunID != uuid.NewSHA1(uuid.NameSpaceOID, []byte(hosts[i].SystemProfile.RHCID)) {
+			t.Errorf("run %v has unexpected run ID: %v", i, run.RunID)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package templates resolves the "state map" that seeds the first profile of
+// an org, either from the org's default template or from the
+// 'service-config' state map validated at startup.
+package templates
+
+import (
+	"config-manager/internal/catalog"
+	"config-manager/internal/db"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// defaultState seeds the first profile of orgs without a default template. It
+// is set by Init.
+var defaultState map[string]string
+
+// Init parses and validates serviceConfig, the state map used to seed the
+// first profile of orgs without a default template.
+func Init(serviceConfig string) error {
+	var state map[string]string
+	if err := json.Unmarshal([]byte(serviceConfig), &state); err != nil {
+		return fmt.Errorf("cannot unmarshal service config: %w", err)
+	}
+
+	if err := catalog.Validate(state); err != nil {
+		return fmt.Errorf("cannot validate service config: %w", err)
+	}
+
+	if violations := catalog.Check(state); len(violations) > 0 {
+		return fmt.Errorf("cannot validate service config: %v", violations[0])
+	}
+
+	defaultState = state
+
+	return nil
+}
+
+// StateForOrg returns the state map that seeds the first profile of orgID,
+// looking up the org's default template in templates.
+func StateForOrg(ctx context.Context, templates db.TemplateRepository, orgID string) (map[string]string, error) {
+	template, err := templates.GetDefaultTemplate(ctx, orgID)
+	if err == nil {
+		return template.State, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("cannot get default template: %w", err)
+	}
+
+	if defaultState == nil {
+		return nil, fmt.Errorf("default state is not initialized")
+	}
+
+	return maps.Clone(defaultState), nil
+}
+
+// CurrentProfile returns the current profile of orgID from profiles, creating
+// it from the org's state map if the org has no profile yet. A created profile
+// is attributed to principal and source.
+func CurrentProfile(ctx context.Context, profiles db.ProfileRepository, templates db.TemplateRepository, orgID string, accountID string, principal string, source string) (*db.Profile, error) {
+	profile, err := profiles.GetCurrentProfile(ctx, orgID)
+	if err == nil {
+		return profile, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("cannot get current profile: %w", err)
+	}
+
+	state, err := StateForOrg(ctx, templates, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	newProfile := db.NewProfile(orgID, accountID, state)
+	newProfile.SetChange(principal, "", source)
+
+	profile, err = profiles.GetOrInsertCurrentProfile(ctx, orgID, newProfile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert current profile: %w", err)
+	}
+
+	return profile, nil
+}
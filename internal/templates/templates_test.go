@@ -0,0 +1,140 @@
+package templates
+
+import (
+	"config-manager/internal/db"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	DSN  string
+	port uint32
+)
+
+func TestMain(m *testing.M) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	port = uint32(r.Int31n(10000-9876) + 9876)
+	DSN = fmt.Sprintf("host=localhost port=%v user=postgres password=postgres dbname=postgres sslmode=disable", port)
+
+	runtimedir, err := os.MkdirTemp("", "config-manager-internal-templates.")
+	if err != nil {
+		log.Fatalf("cannot make temp dir: %v", err)
+	}
+	postgres := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().Port(port).RuntimePath(runtimedir))
+
+	if err := postgres.Start(); err != nil {
+		log.Fatalf("failed to start database: %v", err)
+	}
+
+	code := m.Run()
+
+	if err := postgres.Stop(); err != nil {
+		log.Fatalf("failed to stop database: %v", err)
+	}
+
+	if err := os.RemoveAll(runtimedir); err != nil {
+		log.Fatalf("cannot remove temp dir: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		wantError   bool
+	}{
+		{
+			description: "valid service config",
+			input:       `{"insights":"enabled","compliance_openscap":"enabled","remediations":"enabled"}`,
+		},
+		{
+			description: "malformed JSON",
+			input:       `{"insights":`,
+			wantError:   true,
+		},
+		{
+			description: "unknown service",
+			input:       `{"insights":"enabled","malware":"enabled"}`,
+			wantError:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := Init(test.input)
+			if test.wantError != (err != nil) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStateForOrg(t *testing.T) {
+	tests := []struct {
+		description string
+		seed        []byte
+		input       string
+		want        map[string]string
+	}{
+		{
+			description: "org with default template",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'rhc', '{"insights":"enabled","remediations":"disabled"}', TRUE), ('78606', 'other', '{"insights":"disabled"}', FALSE);`),
+			input:       "78606",
+			want:        map[string]string{"insights": "enabled", "remediations": "disabled"},
+		},
+		{
+			description: "org without default template",
+			seed:        []byte(`INSERT INTO profile_templates (org_id, name, state, is_default) VALUES ('78606', 'other', '{"insights":"disabled"}', FALSE);`),
+			input:       "78606",
+			want:        map[string]string{"insights": "enabled", "remediations": "enabled", "compliance_openscap": "enabled"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			database, err := db.Open("pgx", DSN)
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			defer func() {
+				if err := database.Close(); err != nil {
+					t.Fatalf("failed to close database: %v", err)
+				}
+			}()
+
+			if err := db.Migrate(database, true); err != nil {
+				t.Fatalf("failed to migrate database: %v", err)
+			}
+
+			templates := db.NewTemplateRepository(database)
+			defer templates.Close()
+
+			if err := db.SeedData(database, test.seed); err != nil {
+				t.Fatalf("failed to seed database: %v", err)
+			}
+
+			if err := Init(`{"insights":"enabled","compliance_openscap":"enabled","remediations":"enabled"}`); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := StateForOrg(context.Background(), templates, test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"config-manager/internal/config"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -20,46 +21,156 @@ var Kafka kafkautil
 
 type kafkautil struct{}
 
-// NewReader creates a configured kafka.Reader.
+// NewReader creates a configured kafka.Reader. Offsets are committed
+// periodically; offsets committed within an interval are merged, keeping the
+// highest offset of each partition, so messages committed out of order never
+// move a partition's committed offset backwards.
+//
+// Partitions without a committed offset are read starting at the configured
+// 'kafka-consumer-offset'.
 func (k kafkautil) NewReader(topic string) *kafka.Reader {
-	var dialer *kafka.Dialer = kafka.DefaultDialer
-
-	if config.DefaultConfig.KafkaSecurityProtocol == "SASL_SSL" {
-
-		saslMechanism, tlsConfig := getSaslAndTLSConfig()
-		dialer = &kafka.Dialer{
-			Timeout:       10 * time.Second,
-			DualStack:     true,
-			TLS:           tlsConfig,
-			SASLMechanism: saslMechanism,
-		}
+	startOffset := config.DefaultConfig.KafkaConsumerOffset
+	if startOffset != kafka.FirstOffset && startOffset != kafka.LastOffset {
+		log.Warn().Int64("offset", startOffset).Msg("invalid kafka consumer offset, reading from last offset")
+		startOffset = kafka.LastOffset
 	}
 
 	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     config.DefaultConfig.KafkaBrokers.Values,
-		Topic:       topic,
-		GroupID:     config.DefaultConfig.KafkaGroupID,
-		StartOffset: kafka.LastOffset,
-		Dialer:      dialer,
+		Brokers:        config.DefaultConfig.KafkaBrokers.Values,
+		Topic:          topic,
+		GroupID:        config.DefaultConfig.KafkaGroupID,
+		StartOffset:    startOffset,
+		Dialer:         newDialer(),
+		CommitInterval: time.Second,
 	})
 }
 
 // NewWriter creates a configured kafka.Writer.
 func (k kafkautil) NewWriter(topic string) *kafka.Writer {
-	var transport *kafka.Transport = kafka.DefaultTransport.(*kafka.Transport)
+	return &kafka.Writer{
+		Addr:      kafka.TCP(config.DefaultConfig.KafkaBrokers.Values...),
+		Topic:     topic,
+		Transport: newTransport(),
+	}
+}
+
+// SeekGroup commits, on behalf of the consumer group, the offset of the first
+// message of each partition of topic written at or after t. Partitions without
+// such a message are moved to their end. Readers of the group created
+// afterwards resume from the committed offsets.
+//
+// SeekGroup joins the consumer group to commit offsets, so other members of
+// the group should be stopped while it runs.
+func (k kafkautil) SeekGroup(ctx context.Context, topic string, t time.Time) (map[int]int64, error) {
+	client := &kafka.Client{
+		Addr:      kafka.TCP(config.DefaultConfig.KafkaBrokers.Values...),
+		Transport: newTransport(),
+	}
+
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get metadata for topic %v: %w", topic, err)
+	}
+	if len(metadata.Topics) != 1 || metadata.Topics[0].Error != nil {
+		return nil, fmt.Errorf("cannot find topic %v", topic)
+	}
+
+	timeRequests := make([]kafka.OffsetRequest, 0, len(metadata.Topics[0].Partitions))
+	lastRequests := make([]kafka.OffsetRequest, 0, len(metadata.Topics[0].Partitions))
+	for _, p := range metadata.Topics[0].Partitions {
+		timeRequests = append(timeRequests, kafka.TimeOffsetOf(p.ID, t))
+		lastRequests = append(lastRequests, kafka.LastOffsetOf(p.ID))
+	}
+
+	last, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: lastRequests}})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list last offsets: %w", err)
+	}
+
+	at, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: timeRequests}})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list offsets at %v: %w", t, err)
+	}
+
+	offsets, err := seekOffsets(last.Topics[topic], at.Topics[topic])
+	if err != nil {
+		return nil, fmt.Errorf("cannot list offsets at %v: %w", t, err)
+	}
 
-	if config.DefaultConfig.KafkaSecurityProtocol == "SASL_SSL" {
-		saslMechanism, tlsConfig := getSaslAndTLSConfig()
-		transport = &kafka.Transport{
-			TLS:  tlsConfig,
-			SASL: saslMechanism,
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          config.DefaultConfig.KafkaGroupID,
+		Brokers:     config.DefaultConfig.KafkaBrokers.Values,
+		Topics:      []string{topic},
+		Dialer:      newDialer(),
+		StartOffset: kafka.LastOffset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create consumer group: %w", err)
+	}
+	defer group.Close()
+
+	generation, err := group.Next(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot join consumer group: %w", err)
+	}
+
+	if err := generation.CommitOffsets(map[string]map[int]int64{topic: offsets}); err != nil {
+		return nil, fmt.Errorf("cannot commit offsets: %w", err)
+	}
+
+	return offsets, nil
+}
+
+// seekOffsets returns the offset of each partition to seek to, given the last
+// offsets of the partitions and the offsets at a point in time. Partitions with
+// no message at or after that time have a negative offset in at, and are moved
+// to their last offset.
+func seekOffsets(last []kafka.PartitionOffsets, at []kafka.PartitionOffsets) (map[int]int64, error) {
+	offsets := make(map[int]int64)
+	for _, p := range last {
+		if p.Error != nil {
+			return nil, fmt.Errorf("cannot list last offset of partition %v: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p.LastOffset
+	}
+	for _, p := range at {
+		if p.Error != nil {
+			return nil, fmt.Errorf("cannot list offset of partition %v: %w", p.Partition, p.Error)
+		}
+		for offset := range p.Offsets {
+			if offset < 0 {
+				continue
+			}
+			offsets[p.Partition] = offset
 		}
 	}
 
-	return &kafka.Writer{
-		Addr:      kafka.TCP(config.DefaultConfig.KafkaBrokers.Values...),
-		Topic:     topic,
-		Transport: transport,
+	return offsets, nil
+}
+
+func newDialer() *kafka.Dialer {
+	if config.DefaultConfig.KafkaSecurityProtocol != "SASL_SSL" {
+		return kafka.DefaultDialer
+	}
+
+	saslMechanism, tlsConfig := getSaslAndTLSConfig()
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: saslMechanism,
+	}
+}
+
+func newTransport() *kafka.Transport {
+	if config.DefaultConfig.KafkaSecurityProtocol != "SASL_SSL" {
+		return kafka.DefaultTransport.(*kafka.Transport)
+	}
+
+	saslMechanism, tlsConfig := getSaslAndTLSConfig()
+	return &kafka.Transport{
+		TLS:  tlsConfig,
+		SASL: saslMechanism,
 	}
 }
 
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestSeekOffsets(t *testing.T) {
+	at := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		description string
+		last        []kafka.PartitionOffsets
+		at          []kafka.PartitionOffsets
+		want        map[int]int64
+		wantError   bool
+	}{
+		{
+			description: "offsets at time",
+			last: []kafka.PartitionOffsets{
+				{Partition: 0, LastOffset: 10},
+				{Partition: 1, LastOffset: 20},
+			},
+			at: []kafka.PartitionOffsets{
+				{Partition: 0, Offsets: map[int64]time.Time{4: at}},
+				{Partition: 1, Offsets: map[int64]time.Time{15: at}},
+			},
+			want: map[int]int64{0: 4, 1: 15},
+		},
+		{
+			description: "no message after time",
+			last: []kafka.PartitionOffsets{
+				{Partition: 0, LastOffset: 10},
+				{Partition: 1, LastOffset: 20},
+			},
+			at: []kafka.PartitionOffsets{
+				{Partition: 0, Offsets: map[int64]time.Time{4: at}},
+				{Partition: 1, Offsets: map[int64]time.Time{-1: {}}},
+			},
+			want: map[int]int64{0: 4, 1: 20},
+		},
+		{
+			description: "partition error",
+			last: []kafka.PartitionOffsets{
+				{Partition: 0, LastOffset: 10},
+			},
+			at: []kafka.PartitionOffsets{
+				{Partition: 0, Error: errors.New("not leader for partition")},
+			},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := seekOffsets(test.last, test.at)
+
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("%v", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
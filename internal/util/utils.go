@@ -2,6 +2,8 @@ package util
 
 import (
 	"strings"
+	"sync"
+	"time"
 )
 
 // NormalizeWhitespace removes extra whitespace characters from a string,
@@ -11,3 +13,20 @@ func NormalizeWhitespace(s string) string {
 	s = strings.TrimSpace(s)
 	return s
 }
+
+// WaitTimeout waits for wg to complete, giving up after timeout. It returns
+// false if wg did not complete in time.
+func WaitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
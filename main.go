@@ -1,18 +1,27 @@
 package main
 
 import (
+	"config-manager/infrastructure/persistence/dispatcher"
+	"config-manager/infrastructure/persistence/inventory"
+	"config-manager/internal/cmd"
+	"config-manager/internal/cmd/dispatcherconsumer"
 	"config-manager/internal/cmd/httpapi"
 	"config-manager/internal/cmd/inventoryconsumer"
+	"config-manager/internal/cmd/prune"
 	"config-manager/internal/config"
 	"config-manager/internal/db"
 	"config-manager/internal/logging/cloudwatch"
+	"config-manager/internal/reconcile"
+	"config-manager/internal/templates"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -29,36 +38,78 @@ import (
 )
 
 func main() {
+	// Subcommands run with ctx, so they shut down gracefully whether they are
+	// run as a module or on their own.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// The subcommands are created before the flags are parsed, but only run
+	// once deps is set up from them.
+	deps := &cmd.Dependencies{}
+	httpAPICommand := httpapi.NewCommand(deps)
+	inventoryConsumerCommand := inventoryconsumer.NewCommand(deps)
+	dispatcherConsumerCommand := dispatcherconsumer.NewCommand(deps)
+	pruneCommand := prune.NewCommand(deps)
+
 	root := ffcli.Command{
 		FlagSet: config.FlagSet("config-manager", flag.ExitOnError),
 		Options: []ff.Option{
 			ff.WithEnvVarPrefix("CM"),
 		},
 		Subcommands: []*ffcli.Command{
-			&httpapi.Command,
-			&inventoryconsumer.Command,
+			httpAPICommand,
+			inventoryConsumerCommand,
+			dispatcherConsumerCommand,
+			pruneCommand,
 		},
 		Exec: func(ctx context.Context, args []string) error {
 			modules := map[string]*ffcli.Command{
-				"http-api":           &httpapi.Command,
-				"inventory-consumer": &inventoryconsumer.Command,
+				"http-api":            httpAPICommand,
+				"inventory-consumer":  inventoryConsumerCommand,
+				"dispatcher-consumer": dispatcherConsumerCommand,
+				"prune":               pruneCommand,
 			}
 
-			quit := make(chan os.Signal, 1)
-			signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+			ctx, stop := context.WithCancel(ctx)
+			defer stop()
+
+			enabled := config.DefaultConfig.Modules.Values()
+
+			// Modules are expected to run until ctx is cancelled, but prune
+			// returns after a single run unless an interval is set.
+			if config.DefaultConfig.Modules.Value["prune"] && config.DefaultConfig.PruneInterval <= 0 {
+				return fmt.Errorf("cannot run prune as a module: prune-interval must be set")
+			}
 
-			for _, module := range config.DefaultConfig.Modules.Values() {
+			errs := make(chan error, len(enabled))
+
+			var wg sync.WaitGroup
+			for _, module := range enabled {
 				subcommand := modules[module]
+				wg.Add(1)
 				go func() {
+					defer wg.Done()
 					if err := subcommand.Exec(ctx, args); err != nil {
-						log.Fatal().Err(err).Msg("cannot run subcommand")
+						log.Error().Err(err).Str("module", module).Msg("cannot run subcommand")
+						errs <- fmt.Errorf("cannot run %v: %w", module, err)
+						// A failed module stops the others so the process exits.
+						stop()
 					}
 				}()
 			}
 
-			<-quit
+			<-ctx.Done()
+			log.Info().Msg("shutting down")
+
+			wg.Wait()
+			close(errs)
 
-			return nil
+			var err error
+			for e := range errs {
+				err = errors.Join(err, e)
+			}
+
+			return err
 		},
 	}
 
@@ -87,10 +138,11 @@ func main() {
 		writers = append(writers, os.Stderr)
 	}
 
+	var batchWriter *cloudwatch.BatchWriter
 	if clowder.IsClowderEnabled() {
 		cred := credentials.NewStaticCredentials(config.DefaultConfig.AWSAccessKeyId, config.DefaultConfig.AWSSecretAccessKey, "")
 		awsCfg := aws.NewConfig().WithRegion(config.DefaultConfig.AWSRegion).WithCredentials(cred)
-		batchWriter, err := cloudwatch.NewBatchWriter(config.DefaultConfig.LogGroup, config.DefaultConfig.LogStream, awsCfg, config.DefaultConfig.LogBatchFrequency)
+		batchWriter, err = cloudwatch.NewBatchWriter(config.DefaultConfig.LogGroup, config.DefaultConfig.LogStream, awsCfg, config.DefaultConfig.LogBatchFrequency)
 		if err != nil {
 			log.Error().Err(err).Msg("cannot create CloudWatch batch writer")
 		}
@@ -101,11 +153,16 @@ func main() {
 
 	log.Logger = log.Output(zerolog.MultiLevelWriter(writers...))
 
+	var metricsServer *http.Server
 	if config.DefaultConfig.MetricsPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle(config.DefaultConfig.MetricsPath, promhttp.Handler())
+		metricsServer = &http.Server{
+			Addr:    fmt.Sprintf("0.0.0.0:%v", config.DefaultConfig.MetricsPort),
+			Handler: mux,
+		}
 		go func() {
-			mux := http.NewServeMux()
-			mux.Handle(config.DefaultConfig.MetricsPath, promhttp.Handler())
-			if err := http.ListenAndServe(fmt.Sprintf("0.0.0.0:%v", config.DefaultConfig.MetricsPort), mux); err != nil {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Fatal().Err(err).Int("metrics-port", config.DefaultConfig.MetricsPort).Msg("cannot listen on port")
 			}
 		}()
@@ -136,15 +193,56 @@ func main() {
 
 	log.Info().Str("sslmode", config.DefaultConfig.DBSSLMode).Msg("connecting to database")
 
-	if err := db.Open("pgx", connectionString); err != nil {
+	database, err := db.Open("pgx", connectionString)
+	if err != nil {
 		log.Fatal().Err(err).Msg("cannot open database")
 	}
 
-	if err := db.Migrate(false); err != nil {
+	if err := db.Migrate(database, false); err != nil {
 		log.Fatal().Err(err).Msg("cannot migrate database")
 	}
 
-	if err := root.Run(context.Background()); err != nil {
-		log.Fatal().Err(err).Msg("unable to run command")
+	// Every subcommand shares the applier, which records the runs it
+	// dispatches in hostRuns.
+	hostRuns := db.NewHostRunRepository(database)
+	dispatcherClient := dispatcher.NewDispatcherClient()
+	deps.DB = database
+	deps.Dispatcher = dispatcherClient
+	deps.Applier = reconcile.NewReconciler(inventory.NewInventoryClient(), dispatcherClient, hostRuns)
+
+	if err := templates.Init(config.DefaultConfig.ServiceConfig); err != nil {
+		log.Fatal().Err(err).Msg("cannot initialize profile templates")
+	}
+
+	runErr := root.Run(ctx)
+	if runErr != nil {
+		log.Error().Err(runErr).Msg("unable to run command")
+	}
+
+	// The metrics server keeps serving while the command shuts down.
+	if metricsServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.DefaultConfig.ShutdownTimeout)
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("cannot shut down metrics server")
+		}
+		cancel()
+	}
+
+	if err := hostRuns.Close(); err != nil {
+		log.Error().Err(err).Msg("cannot close host run repository")
+	}
+
+	if err := database.Close(); err != nil {
+		log.Error().Err(err).Msg("cannot close database")
+	}
+
+	if batchWriter != nil {
+		if err := batchWriter.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot flush CloudWatch batch writer: %v\n", err)
+		}
+	}
+
+	if runErr != nil {
+		os.Exit(1)
 	}
 }